@@ -0,0 +1,655 @@
+package localcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MoeYang/go-localcache/common"
+	"github.com/MoeYang/go-localcache/datastruct/arena"
+	"github.com/MoeYang/go-localcache/datastruct/sketch"
+)
+
+// ErrNotBytes is passed to the error handler when set a value which is not []byte to an arena cache
+var ErrNotBytes = errors.New("localcache: value of arena cache must be []byte")
+
+// arenaCache keep []byte values in ring buffers of shards, keys are evicted from the oldest set
+type arenaCache struct {
+	shards   []*arenaShard
+	shardCnt int
+
+	ttl int64 // Global Keys expire seconds
+
+	// keys of every tag
+	tagIndex *tagIndex
+	// heavy hitters of hits, nil if not enable
+	hotKeys *sketch.TopK
+	// namespaces created by Namespace
+	namespaces namespaces
+
+	// codec to encode values in snapshot
+	codec Codec
+	// save snapshot to persistPath every persistInterval, "" if not enable
+	persistPath     string
+	persistInterval time.Duration
+	onError         func(err error)
+
+	closed    int32
+	closeOnce sync.Once
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	doneChan  chan struct{}
+	// expireTick is called by the ticker of Manager, no ttlProcess
+	sharedTicker bool
+
+	statist statist
+	group   common.Group
+}
+
+// arenaShard is a ring buffer and the tags of its keys
+type arenaShard struct {
+	lock  sync.RWMutex
+	arena *arena.Arena
+	// tags of keys set with tags, most keys have no tags so it is small
+	tags map[string][]string
+
+	cache *arenaCache
+}
+
+// NewArenaCache return a Cache keeps []byte values in ring buffers of size bytes in total,
+// every shard owns size/shardCnt bytes and overwrites its oldest entries when full.
+// Values are copied in and out, so there is few pointers for GC to scan even with millions of keys.
+// Set a value which is not []byte is passed ErrNotBytes to the error handler, and the key is not cached.
+// An entry larger than the buffer of shard is not cached.
+// Options of capacity, weigher, policy, prefix index, compression, disk tier, backing store and write buffer are ignored.
+func NewArenaCache(size int, options ...Option) Cache {
+	// options set fields of localCache, read what arena cache use from it
+	opts := &localCache{
+		shardCnt: defaultShardCnt,
+		ttl:      defaultTTL,
+		statist:  newstatisCaculator(false),
+		codec:    GobCodec,
+		onError:  defaultOnError,
+	}
+	for _, opt := range options {
+		opt(opts)
+	}
+	c := &arenaCache{
+		shards:          make([]*arenaShard, opts.shardCnt),
+		shardCnt:        opts.shardCnt,
+		ttl:             opts.ttl,
+		tagIndex:        newTagIndex(),
+		hotKeys:         opts.hotKeys,
+		codec:           opts.codec,
+		persistPath:     opts.persistPath,
+		persistInterval: opts.persistInterval,
+		onError:         opts.onError,
+		stopChan:        make(chan struct{}),
+		doneChan:        make(chan struct{}),
+		statist:         opts.statist,
+		sharedTicker:    opts.sharedTicker,
+	}
+	for i := range c.shards {
+		s := &arenaShard{tags: make(map[string][]string), cache: c}
+		s.arena = arena.New(size/c.shardCnt, s.evict)
+		c.shards[i] = s
+	}
+	c.start()
+	// warm start from snapshot
+	if c.persistPath != "" {
+		if err := loadFile(c.persistPath, c.Load); err != nil {
+			c.onError(err)
+		}
+	}
+	return c
+}
+
+func (c *arenaCache) Get(key string) (interface{}, bool) {
+	if c.isClosed() {
+		return nil, false
+	}
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.RLock()
+	value, expireTime, has := s.arena.Get(hash, key)
+	if has && time.Now().Unix() <= expireTime {
+		// value is in buffer, copy it out
+		value = append([]byte(nil), value...)
+		s.lock.RUnlock()
+		c.statist.hitIncr()
+		if c.hotKeys != nil {
+			c.hotKeys.Add(key)
+		}
+		return value, true
+	}
+	s.lock.RUnlock()
+	if has {
+		c.expire(hash, key)
+	}
+	c.statist.missIncr()
+	return nil, false
+}
+
+// Peek get a key without counting a hit or miss and without deleting it if expired
+func (c *arenaCache) Peek(key string) (interface{}, bool) {
+	if c.isClosed() {
+		return nil, false
+	}
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	value, expireTime, has := s.arena.Get(hash, key)
+	if !has || time.Now().Unix() > expireTime {
+		return nil, false
+	}
+	return append([]byte(nil), value...), true
+}
+
+func (c *arenaCache) GetOrLoad(key string, f LoadFunc) (interface{}, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	if res, has := c.Get(key); has {
+		return res, nil
+	}
+	loadF := func() (interface{}, error) {
+		start := time.Now()
+		res, err := f()
+		c.statist.loadIncr(time.Since(start), err)
+		if err == nil {
+			c.Set(key, res)
+		}
+		return res, err
+	}
+	res, err, shared := c.group.DoShared(key, loadF)
+	if shared {
+		c.statist.sharedLoadIncr()
+	}
+	return res, err
+}
+
+func (c *arenaCache) Set(key string, value interface{}) {
+	c.SetWithExpire(key, value, c.ttl)
+}
+
+func (c *arenaCache) SetWithExpire(key string, value interface{}, ttl int64) {
+	c.SetWithTags(key, value, ttl)
+}
+
+// SetWithTags set a key-value and replace the tags of key
+func (c *arenaCache) SetWithTags(key string, value interface{}, ttl int64, tags ...string) {
+	if c.isClosed() {
+		return
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		c.onError(ErrNotBytes)
+		c.Del(key)
+		return
+	}
+	c.statist.setIncr()
+	expireTime := time.Now().Add(time.Duration(ttl) * time.Second).Unix()
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.Lock()
+	s.removeTags(key)
+	if s.arena.Set(hash, key, data, expireTime) && len(tags) > 0 {
+		s.tags[key] = tags
+		c.tagIndex.add(key, tags)
+	}
+	s.lock.Unlock()
+}
+
+// GetWithVersion get a key and return the version of the value
+func (c *arenaCache) GetWithVersion(key string) (interface{}, uint64, bool) {
+	if c.isClosed() {
+		return nil, 0, false
+	}
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.RLock()
+	value, expireTime, has := s.arena.Get(hash, key)
+	if has && time.Now().Unix() <= expireTime {
+		value = append([]byte(nil), value...)
+		version, _ := s.arena.Version(hash, key)
+		s.lock.RUnlock()
+		c.statist.hitIncr()
+		if c.hotKeys != nil {
+			c.hotKeys.Add(key)
+		}
+		return value, version, true
+	}
+	s.lock.RUnlock()
+	if has {
+		c.expire(hash, key)
+	}
+	c.statist.missIncr()
+	return nil, 0, false
+}
+
+// CompareAndSwap set a key-value and remove the tags of key only if the version of key is still version
+func (c *arenaCache) CompareAndSwap(key string, value interface{}, ttl int64, version uint64) bool {
+	if c.isClosed() {
+		return false
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		c.onError(ErrNotBytes)
+		return false
+	}
+	expireTime := time.Now().Add(time.Duration(ttl) * time.Second).Unix()
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, oldExpireTime, has := s.arena.Get(hash, key)
+	if current, _ := s.arena.Version(hash, key); !has || current != version || time.Now().Unix() > oldExpireTime {
+		return false
+	}
+	c.statist.setIncr()
+	s.removeTags(key)
+	s.arena.Set(hash, key, data, expireTime)
+	return true
+}
+
+// GetMulti get keys and return values of keys exist
+func (c *arenaCache) GetMulti(keys []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if value, has := c.Get(key); has {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// Del delete key and return if the key exists
+func (c *arenaCache) Del(key string) bool {
+	_, has := c.GetAndDelete(key)
+	return has
+}
+
+// Invalidate is the same as Del, arena cache has no backing store
+func (c *arenaCache) Invalidate(key string) bool {
+	return c.Del(key)
+}
+
+// GetAndDelete get a key and delete it
+func (c *arenaCache) GetAndDelete(key string) (interface{}, bool) {
+	if c.isClosed() {
+		return nil, false
+	}
+	if c.hotKeys != nil {
+		// a deleted key is not reported by TopKeys
+		c.hotKeys.Remove(key)
+	}
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.Lock()
+	value, expireTime, has := s.arena.Get(hash, key)
+	if !has {
+		s.lock.Unlock()
+		return nil, false
+	}
+	value = append([]byte(nil), value...)
+	s.arena.Del(hash, key)
+	s.removeTags(key)
+	s.lock.Unlock()
+	c.statist.delIncr()
+	if time.Now().Unix() > expireTime {
+		return nil, false
+	}
+	return value, true
+}
+
+// DelPrefix delete all keys start with prefix
+func (c *arenaCache) DelPrefix(prefix string) int {
+	var count int
+	for _, key := range c.Keys() {
+		if strings.HasPrefix(key, prefix) && c.Del(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// DelMatch delete all keys match the glob pattern
+func (c *arenaCache) DelMatch(pattern string) int {
+	var count int
+	for _, key := range c.Keys() {
+		if common.MatchGlob(pattern, key) && c.Del(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// InvalidateTag delete all keys associated with tag
+func (c *arenaCache) InvalidateTag(tag string) int {
+	var count int
+	for _, key := range c.tagIndex.keys(tag) {
+		if c.Del(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// TTL return the remaining time to live of key
+func (c *arenaCache) TTL(key string) (time.Duration, bool) {
+	if c.isClosed() {
+		return 0, false
+	}
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.RLock()
+	_, expireTime, has := s.arena.Get(hash, key)
+	s.lock.RUnlock()
+	if !has || time.Now().Unix() > expireTime {
+		return 0, false
+	}
+	return time.Until(time.Unix(expireTime, 0)), true
+}
+
+// Touch set seconds to live of key without changing its value and version
+func (c *arenaCache) Touch(key string, ttl int64) bool {
+	if c.isClosed() {
+		return false
+	}
+	hash := common.Hash64(key)
+	s := c.shard(hash)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, expireTime, has := s.arena.Get(hash, key)
+	if !has || time.Now().Unix() > expireTime {
+		return false
+	}
+	return s.arena.Touch(hash, key, time.Now().Add(time.Duration(ttl)*time.Second).Unix())
+}
+
+// Keys return all keys not expired in cache
+func (c *arenaCache) Keys() []string {
+	if c.isClosed() {
+		return nil
+	}
+	now := time.Now().Unix()
+	keys := make([]string, 0, c.Len())
+	for _, s := range c.shards {
+		s.lock.RLock()
+		s.arena.Range(func(key, _ []byte, expireTime int64) bool {
+			if now <= expireTime {
+				keys = append(keys, string(key))
+			}
+			return true
+		})
+		s.lock.RUnlock()
+	}
+	return keys
+}
+
+// Len return count of keys in cache
+func (c *arenaCache) Len() int {
+	var n int
+	for _, s := range c.shards {
+		s.lock.RLock()
+		n += s.arena.Len()
+		s.lock.RUnlock()
+	}
+	return n
+}
+
+// Flush clear all keys in cache
+func (c *arenaCache) Flush() {
+	for _, s := range c.shards {
+		s.lock.Lock()
+	}
+	for _, s := range c.shards {
+		s.arena.Reset()
+		s.tags = make(map[string][]string)
+	}
+	c.tagIndex.flush()
+	if c.hotKeys != nil {
+		c.hotKeys.Reset()
+	}
+	for _, s := range c.shards {
+		s.lock.Unlock()
+	}
+}
+
+// Close wait background goroutines exit and do the final save
+func (c *arenaCache) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		close(c.stopChan)
+		go func() {
+			c.wg.Wait()
+			if c.persistPath != "" {
+				if err := persistFile(c.persistPath, c.save); err != nil {
+					c.onError(err)
+				}
+			}
+			close(c.doneChan)
+		}()
+	})
+	select {
+	case <-c.doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop the cache, same as Close without timeout
+func (c *arenaCache) Stop() {
+	_ = c.Close(context.Background())
+}
+
+func (c *arenaCache) Statistic() map[string]interface{} {
+	var stats Stats
+	c.statist.fill(&stats)
+	return map[string]interface{}{
+		"hit":          c.statist.GetHitCount(),
+		"miss":         c.statist.GetMissCount(),
+		"hitRate":      c.statist.GetHitRate(),
+		"backpressure": c.statist.GetBackpressureCount(),
+		"droppedHits":  uint64(0),
+		"hitRate1m":    stats.Last1m.HitRate(),
+		"hitRate5m":    stats.Last5m.HitRate(),
+		"hitRate15m":   stats.Last15m.HitRate(),
+	}
+}
+
+// Stats return a typed snapshot of cache statistic, Weight is the bytes used in buffers
+func (c *arenaCache) Stats() Stats {
+	var stats Stats
+	c.statist.fill(&stats)
+	for _, s := range c.shards {
+		s.lock.RLock()
+		stats.Entries += s.arena.Len()
+		stats.Weight += int64(s.arena.Used())
+		s.lock.RUnlock()
+	}
+	return stats
+}
+
+// TopKeys return at most k hottest keys, nil if not WithHotKeys
+func (c *arenaCache) TopKeys(k int) []KeyCount {
+	if c.hotKeys == nil {
+		return nil
+	}
+	items := c.hotKeys.List(k)
+	keys := make([]KeyCount, len(items))
+	for i, item := range items {
+		keys[i] = KeyCount{Key: item.Key, Count: uint64(item.Count)}
+	}
+	return keys
+}
+
+// Save write keys not expired to w from the oldest set to the newest
+func (c *arenaCache) Save(w io.Writer) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	return c.save(w)
+}
+
+// Load read keys saved by Save and set them to cache with the remaining ttl
+func (c *arenaCache) Load(r io.Reader) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	return readSnapshot(r, c.codec, c.setSnapshot)
+}
+
+// loadPrefix read keys saved by Save and set them to cache with prefix added to keys and tags
+func (c *arenaCache) loadPrefix(r io.Reader, prefix string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	return readSnapshot(r, c.codec, addPrefix(prefix, c.setSnapshot))
+}
+
+// setSnapshot set a key read from snapshot, priority and pinned are ignored
+func (c *arenaCache) setSnapshot(key string, value interface{}, ttl int64, tags []string, _ entryMeta) {
+	c.SetWithTags(key, value, ttl, tags...)
+}
+
+func (c *arenaCache) save(w io.Writer) error {
+	return c.savePrefix(w, "")
+}
+
+// savePrefix write keys start with prefix to w without the prefix, tags without the prefix are dropped
+func (c *arenaCache) savePrefix(w io.Writer, prefix string) error {
+	bw := bufio.NewWriter(w)
+	writeSnapshotHeader(bw)
+	buf := make([]byte, binary.MaxVarintLen64)
+	now := time.Now().Unix()
+	for _, s := range c.shards {
+		var err error
+		s.lock.RLock()
+		s.arena.Range(func(key, value []byte, expireTime int64) bool {
+			name, tags, has := trimPrefix(prefix, string(key), s.tags[string(key)])
+			if !has || expireTime < now {
+				return true
+			}
+			var data []byte
+			if data, err = c.codec.Marshal(value); err != nil {
+				return false
+			}
+			writeRecord(bw, buf, name, expireTime, tags, data, entryMeta{})
+			return true
+		})
+		s.lock.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+	bw.WriteByte(recordEnd)
+	return bw.Flush()
+}
+
+// start background goroutines
+func (c *arenaCache) start() {
+	if !c.sharedTicker {
+		c.wg.Add(1)
+		go c.ttlProcess()
+	}
+	if c.persistPath != "" && c.persistInterval > 0 {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			persistLoop(c.stopChan, c.persistInterval, func() error {
+				return persistFile(c.persistPath, c.save)
+			}, c.onError)
+		}()
+	}
+}
+
+// ttlProcess run a loop to delete the keys which are expired, like localCache check rand keys of every shard
+func (c *arenaCache) ttlProcess() {
+	defer c.wg.Done()
+	t := time.NewTicker(defaultTTLTick * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-t.C:
+			c.expireTick()
+		}
+	}
+}
+
+// expireTick delete the keys which are expired, it is called every tick by ttlProcess or the ticker of Manager
+func (c *arenaCache) expireTick() {
+	ti := time.Now()
+	for _, s := range c.shards {
+		if time.Since(ti) >= defaultTTLCheckRunTime*time.Millisecond {
+			break
+		}
+		var delCount = defaultTTLCheckCount
+		for delCount > defaultTTLCheckPercent &&
+			time.Since(ti) < defaultTTLCheckRunTime*time.Millisecond {
+			s.lock.Lock()
+			_, delCount = s.arena.DelExpired(time.Now().Unix(), defaultTTLCheckCount)
+			s.lock.Unlock()
+		}
+	}
+}
+
+// expire del the key if it is expired
+func (c *arenaCache) expire(hash uint64, key string) {
+	s := c.shard(hash)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, expireTime, has := s.arena.Get(hash, key)
+	if !has || time.Now().Unix() <= expireTime {
+		// set again before we lock it
+		return
+	}
+	s.arena.Del(hash, key)
+	s.removeTags(key)
+	c.statist.expireIncr()
+	c.namespaces.of(key).expireIncr()
+}
+
+func (c *arenaCache) shard(hash uint64) *arenaShard {
+	return c.shards[hash&uint64(c.shardCnt-1)]
+}
+
+// isClosed return whether Close is called
+func (c *arenaCache) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+// evict called by arena with shard lock when a live entry is overwritten or deleted because expired
+func (s *arenaShard) evict(key []byte, expireTime int64) {
+	ns := s.cache.namespaces.of(string(key))
+	if time.Now().Unix() > expireTime {
+		s.cache.statist.expireIncr()
+		ns.expireIncr()
+	} else {
+		s.cache.statist.evictIncr(evictByCapacity)
+		ns.evictIncr(evictByCapacity)
+	}
+	if _, has := s.tags[string(key)]; has {
+		s.removeTags(string(key))
+	}
+}
+
+// removeTags remove key from tags index, must be called with shard lock
+func (s *arenaShard) removeTags(key string) {
+	tags, has := s.tags[key]
+	if !has {
+		return
+	}
+	s.cache.tagIndex.remove(key, tags)
+	delete(s.tags, key)
+}
@@ -0,0 +1,88 @@
+package localcache
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestArenaCache(t *testing.T) {
+	var errs []error
+	c := NewArenaCache(1<<20, WithStatist(true), WithErrorHandler(func(err error) { errs = append(errs, err) }))
+	defer c.Stop()
+	c.Set("a", []byte("1"))
+	if v, has := c.Get("a"); !has || string(v.([]byte)) != "1" {
+		t.Errorf("TestArenaCache1 get a = %v, %v", v, has)
+	}
+	c.Set("b", 2)
+	if _, has := c.Get("b"); has || len(errs) != 1 || errs[0] != ErrNotBytes {
+		t.Errorf("TestArenaCache2 set not bytes, errs %v", errs)
+	}
+	c.SetWithTags("t1", []byte("1"), 10, "tag")
+	c.SetWithTags("t2", []byte("2"), 10, "tag")
+	if n := c.InvalidateTag("tag"); n != 2 {
+		t.Errorf("TestArenaCache3 invalidate tag %d <> 2", n)
+	}
+	c.SetWithExpire("expired", []byte("1"), -1)
+	if _, has := c.Get("expired"); has {
+		t.Error("TestArenaCache4 get expired key")
+	}
+	if ttl, has := c.TTL("a"); !has || ttl <= 0 {
+		t.Errorf("TestArenaCache5 ttl of a %v, %v", ttl, has)
+	}
+	if v, has := c.GetAndDelete("a"); !has || string(v.([]byte)) != "1" || c.Len() != 0 {
+		t.Errorf("TestArenaCache6 get and delete a = %v, %v, len %d", v, has, c.Len())
+	}
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Expirations != 1 || stats.Sets != 4 {
+		t.Errorf("TestArenaCache7 stats %+v", stats)
+	}
+}
+
+func TestArenaCacheEvict(t *testing.T) {
+	// 1 shard of 1000 bytes keeps 20 entries of 50 bytes
+	c := NewArenaCache(1000, WithShardCount(1), WithStatist(true))
+	defer c.Stop()
+	for i := 0; i < 100; i++ {
+		c.Set(strconv.Itoa(i+100), make([]byte, 15))
+	}
+	if c.Len() != 20 || c.Stats().Evictions.Capacity != 80 {
+		t.Errorf("TestArenaCacheEvict1 len %d evictions %d", c.Len(), c.Stats().Evictions.Capacity)
+	}
+	if _, has := c.Get("199"); !has {
+		t.Error("TestArenaCacheEvict2 newest key evicted")
+	}
+	if n := c.DelPrefix("19"); n != 10 {
+		t.Errorf("TestArenaCacheEvict3 del prefix %d <> 10", n)
+	}
+	c.Flush()
+	if c.Len() != 0 || len(c.Keys()) != 0 {
+		t.Errorf("TestArenaCacheEvict4 len %d after flush", c.Len())
+	}
+}
+
+func TestArenaCacheSaveLoad(t *testing.T) {
+	c := NewArenaCache(1 << 20)
+	c.SetWithTags("a", []byte("1"), 100, "tag")
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatalf("TestArenaCacheSaveLoad1 err=%v", err)
+	}
+	c.Stop()
+	if _, has := c.Get("a"); has {
+		t.Error("TestArenaCacheSaveLoad2 get after close")
+	}
+
+	c = NewArenaCache(1 << 20)
+	defer c.Stop()
+	if err := c.Load(&buf); err != nil {
+		t.Fatalf("TestArenaCacheSaveLoad3 err=%v", err)
+	}
+	if ttl, _ := c.TTL("a"); ttl <= 98*time.Second {
+		t.Errorf("TestArenaCacheSaveLoad4 ttl of a %v", ttl)
+	}
+	if n := c.InvalidateTag("tag"); n != 1 {
+		t.Errorf("TestArenaCacheSaveLoad5 invalidate tag %d <> 1", n)
+	}
+}
@@ -1,11 +1,21 @@
 package localcache
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MoeYang/go-localcache/common"
 	"github.com/MoeYang/go-localcache/datastruct/dict"
+	"github.com/MoeYang/go-localcache/datastruct/lock"
+	"github.com/MoeYang/go-localcache/datastruct/logstore"
+	"github.com/MoeYang/go-localcache/datastruct/sketch"
+	"github.com/MoeYang/go-localcache/datastruct/trie"
 )
 
 const (
@@ -18,54 +28,175 @@ const (
 	defaultTTLCheckPercent = 25  // every check expierd key > 25, check another time
 	defaultTTLCheckRunTime = 50  // max run time for a tick
 
-	hitChanLen = 1 << 15 // 32768
-	addChanLen = 1 << 15
+	addChanLen = 1 << 15 // 32768
 
-	opTypeDel = uint8(1)
-	opTypeAdd = uint8(2)
+	opTypeDel   = uint8(1)
+	opTypeAdd   = uint8(2)
+	opTypeFlush = uint8(3)
+	opTypeSync  = uint8(4) // do nothing, wait ops before it are done
 )
 
+const (
+	// WriteBufferBlock wait until opChan has space, the default policy
+	WriteBufferBlock = "block"
+	// WriteBufferDropOldest wait timeout, then drop the oldest op in opChan to make space.
+	// A dropped set is undone so the key is not cached, a dropped del keeps a dead obj in policy until it is evicted.
+	WriteBufferDropOldest = "drop_oldest"
+	// WriteBufferApplyInline wait timeout, then apply the op to policy in caller goroutine
+	WriteBufferApplyInline = "apply_inline"
+)
+
+// ErrClosed is returned when use a cache after Close
+var ErrClosed = errors.New("localcache: cache is closed")
+
 type Cache interface {
 	// Get a key and return the value and if the key exists
 	Get(key string) (interface{}, bool)
+	// Peek get a key without side effects: no hit or miss is counted, the key is not promoted and not loaded
+	Peek(key string) (interface{}, bool)
 	// GetOrLoad get a key, while not exists, call f() to load data
 	GetOrLoad(key string, f LoadFunc) (interface{}, error)
 	// Set a key-value with default seconds to live
 	Set(key string, value interface{})
 	// SetWithExpire set a key-value with seconds to live
 	SetWithExpire(key string, value interface{}, ttl int64)
-	// Del delete key
-	Del(key string)
+	// SetWithTags set a key-value with seconds to live, and associate it with tags
+	SetWithTags(key string, value interface{}, ttl int64, tags ...string)
+	// SetWithOptions set a key-value with ttl, priority and whether it is pinned
+	SetWithOptions(key string, value interface{}, opts Options)
+	// InvalidateTag delete all keys associated with tag, return count of keys deleted
+	InvalidateTag(tag string) int
+	// Del delete key and return if the key exists, a Get after Del will miss
+	Del(key string) bool
+	// Invalidate delete key from cache only, not from backing store, return if the key exists
+	Invalidate(key string) bool
+	// GetWithVersion get a key and return the value, its version and if the key exists, every set of a key changes its version
+	GetWithVersion(key string) (interface{}, uint64, bool)
+	// CompareAndSwap set a key-value with seconds to live only if the version of key is still version, return if it is set
+	CompareAndSwap(key string, value interface{}, ttl int64, version uint64) bool
+	// GetAndDelete get a key and delete it, return the value and if the key exists
+	GetAndDelete(key string) (interface{}, bool)
+	// DelPrefix delete all keys start with prefix from cache only, return count of keys deleted
+	DelPrefix(prefix string) int
+	// DelMatch delete all keys match the glob pattern like "tenant:*:user" from cache only, return count of keys deleted
+	DelMatch(pattern string) int
+	// GetMulti get keys and return values of keys exist, misses read through backing store by one GetMulti
+	GetMulti(keys []string) map[string]interface{}
+	// TTL return the remaining time to live of key and if the key exists
+	TTL(key string) (time.Duration, bool)
+	// Touch set seconds to live of key without changing its value and version, return if the key exists
+	Touch(key string, ttl int64) bool
+	// Keys return all keys not expired in cache, in no order
+	Keys() []string
 	// Len return count of keys in cache
 	Len() int
-	// Flush clear all keys in chache, should do this when set and del is stop
+	// Flush clear all keys in cache, safe to call while set and del
 	Flush()
-	// Stop the cacheProcess by close stopChan
+	// Close drain the ops in queue and wait background goroutines exit, or return ctx.Err() when ctx done.
+	// Close can be called many times, after Close writes are no-op and GetOrLoad return ErrClosed.
+	Close(ctx context.Context) error
+	// Stop the cache, same as Close without timeout
 	Stop()
-	// Statistic return cache Statistic {"hit":1, "miss":1, "hitRate":50.0}
+	// Statistic return cache Statistic {"hit":1, "miss":1, "hitRate":50.0, "backpressure":0, "droppedHits":0, "hitRate1m":50.0, ...}
 	Statistic() map[string]interface{}
+	// Stats return a typed snapshot of cache statistic
+	Stats() Stats
+	// TopKeys return at most k hottest keys and their estimate hit counts, need WithHotKeys
+	TopKeys(k int) []KeyCount
+	// Save write keys not expired with remaining ttl and LRU order to w, values are encoded by codec
+	Save(w io.Writer) error
+	// Load read keys written by Save and set them to cache
+	Load(r io.Reader) error
+	// Namespace return a view of cache whose keys and tags are isolated from other namespaces,
+	// its keys are limited by quota of weight and evicted inside the namespace, quota <= 0 means no quota
+	Namespace(name string, quota int) Cache
 }
 
 // LoadFunc is called to load data from user storage
 type LoadFunc func() (interface{}, error)
 
+// KeyCount is a key and its estimate count
+type KeyCount struct {
+	Key   string
+	Count uint64
+}
+
+// Weigher return the weight of a key-value, capacity is the max total weight of keys
+type Weigher func(key string, value interface{}) int64
+
 type localCache struct {
 	// elimination policy of keys
 	policy     policy
 	policyType string
+	// policy of every shard in sharded mode, nil if not enable
+	shardPolicies []policy
+	shardedPolicy bool
 
 	// data dict
 	dict     dict.Dict
 	shardCnt int // shardings count
 	cap      int // capacity
+	weigher  Weigher
+	weight   int64  // total weight of keys in dict
+	version  uint64 // version of the last set, every set get a new greater version
+	// total weight of pinned keys, at most maxPinnedWeight
+	pinnedWeight    int64
+	maxPinnedWeight int64
+	// keyLock make set and del of the same key serial, so dict and indexes change together
+	keyLock *lock.Locker
+
+	ttl int64 // Global Keys expire seconds
+
+	// prefix index of keys, nil if not enable
+	prefixIndex *trie.Trie
+	// keys of every tag
+	tagIndex *tagIndex
+	// heavy hitters of hits, nil if not enable
+	hotKeys *sketch.TopK
+	// namespaces created by Namespace
+	namespaces namespaces
+
+	// codec to encode values out of memory
+	codec Codec
+	// store values encoded by codec and compressed, nil if not enable
+	compression Compression
+	// save snapshot to persistPath every persistInterval, "" if not enable
+	persistPath     string
+	persistInterval time.Duration
+	// onError is called with errors of background goroutines
+	onError func(err error)
+	// backing store which misses read through and writes propagate to, nil if not enable
+	store          Store
+	storeWriteMode string
+	storeGroup     common.Group // singleFlight of read through
+	// dirty keys to write behind, nil if not WriteBehind
+	writeBehindQueue  *writeBehindQueue
+	writeBehindConfig WriteBehindConfig
 
-	// ttl dict
-	ttlDict dict.Dict
-	ttl     int64 // Global Keys expire seconds
+	// disk tier which evicted keys are written to, nil if not enable
+	disk         *diskTier
+	diskDir      string
+	diskCapacity int64
 
-	hitChan  chan interface{} // chan while get a key should put in
-	opChan   chan opMsg       // add del and add msg in one chan, so we can do options order by time acs
-	stopChan chan struct{}    // chan stop signal
+	readBuf  *readBuffer   // buffer while get a key should put in
+	opChan   chan opMsg    // add del and add msg in one chan, so we can do options order by time acs
+	stopChan chan struct{} // chan stop signal
+
+	// what to do when opChan is full
+	writeBufferPolicy  string
+	writeBufferTimeout time.Duration
+	// policyLock make policy ops safe when ops are applied out of cacheProcess
+	policyLock sync.Mutex
+
+	// closed is 1 after Close, closeLock make sure no one send to opChan after closed
+	closed    int32
+	closeLock sync.RWMutex
+	closeOnce sync.Once
+	wg        sync.WaitGroup // wait background goroutines exit
+	doneChan  chan struct{}  // closed when background goroutines exit
+
+	// expireTick is called by the ticker of Manager, no ttlProcess
+	sharedTicker bool
 
 	// cache statist
 	statist statist
@@ -80,22 +211,61 @@ func NewLocalCache(options ...Option) Cache {
 		shardCnt: defaultShardCnt,
 		cap:      defaultCap,
 		ttl:      defaultTTL,
-		hitChan:  make(chan interface{}, hitChanLen),
+		readBuf:  newReadBuffer(),
 		opChan:   make(chan opMsg, addChanLen),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
 		statist:  newstatisCaculator(false),
+		tagIndex: newTagIndex(),
+		codec:    GobCodec,
+		onError:  defaultOnError,
 	}
 	// set options
 	for _, opt := range options {
 		opt(c)
 	}
+	if c.maxPinnedWeight <= 0 {
+		c.maxPinnedWeight = int64(c.cap) / 2
+	}
 	// init dict
 	c.dict = dict.NewDict(c.shardCnt)
-	// init ttl dict
-	c.ttlDict = dict.NewDict(c.shardCnt)
+	// init key locker
+	c.keyLock = lock.NewLocker(uint32(c.shardCnt))
 	// init policy
-	c.policy = newPolicy(c.policyType, c.cap, c)
+	c.policy = newPolicy(c.policyType, c.cap, c.evict, c.canEvict)
+	if c.shardedPolicy {
+		// every shard owns cap/shardCnt, at least 1
+		shardCap := c.cap / c.shardCnt
+		if shardCap < 1 {
+			shardCap = 1
+		}
+		c.shardPolicies = make([]policy, c.shardCnt)
+		for i := range c.shardPolicies {
+			c.shardPolicies[i] = newPolicy(c.policyType, shardCap, c.evictLocked, c.canEvict)
+		}
+	}
+	// init write-behind queue
+	if c.store != nil && c.storeWriteMode == WriteBehind {
+		c.writeBehindConfig.setDefault()
+		c.writeBehindQueue = newWriteBehindQueue(c.writeBehindConfig.BatchSize)
+	}
+	// open disk tier
+	if c.diskDir != "" {
+		disk, err := logstore.Open(c.diskDir, c.diskCapacity)
+		if err != nil {
+			c.onError(err)
+		} else {
+			c.disk = newDiskTier(disk)
+		}
+	}
 	// start goroutine
 	c.start()
+	// warm start from snapshot
+	if c.persistPath != "" {
+		if err := c.loadPersist(); err != nil {
+			c.onError(err)
+		}
+	}
 
 	return c
 }
@@ -122,6 +292,14 @@ func WithCapacity(cap int) Option {
 	}
 }
 
+// WithWeigher set the weigher of key-value, then capacity is the max total weight of keys.
+// Default every key weighs 1, so capacity is the max count of keys.
+func WithWeigher(weigher Weigher) Option {
+	return func(c *localCache) {
+		c.weigher = weigher
+	}
+}
+
 // WithShardCount shardCnt must be a power of 2
 func WithShardCount(shardCnt int) Option {
 	if shardCnt <= 0 {
@@ -139,6 +317,103 @@ func WithPolicy(policyType string) Option {
 	}
 }
 
+// WithPrefixIndex set whether need to keep a radix tree index of keys beside the dict, default false.
+// With index DelPrefix and DelMatch need not to scan all shards, but set and del cost a little more.
+func WithPrefixIndex(needIndex bool) Option {
+	return func(c *localCache) {
+		if needIndex {
+			c.prefixIndex = trie.New()
+		}
+	}
+}
+
+// WithShardedPolicy set whether every shard owns a policy with capacity cap/shardCnt, default false.
+// Policy of shard is updated inline under the shard lock instead of by the single cacheProcess,
+// so writes scale with cores, and keys are evicted by an approximate global LRU.
+// If cap < shardCnt, every shard still keep 1 key.
+func WithShardedPolicy(sharded bool) Option {
+	return func(c *localCache) {
+		c.shardedPolicy = sharded
+	}
+}
+
+// WithHotKeys set how many hottest keys to track by hits, default 0 not track.
+// Hits are counted by a count-min sketch which halves counts periodically, so TopKeys favor recent hits.
+func WithHotKeys(k int) Option {
+	return func(c *localCache) {
+		if k > 0 {
+			c.hotKeys = sketch.NewTopK(k)
+		}
+	}
+}
+
+// WithCodec set the codec to encode values when save snapshot, default GobCodec
+func WithCodec(codec Codec) Option {
+	return func(c *localCache) {
+		if codec != nil {
+			c.codec = codec
+		}
+	}
+}
+
+// WithCompression store values as bytes encoded by codec and compressed, values are decoded on Get.
+// The weigher is called with the stored bytes, so the weight can be the compressed size.
+func WithCompression(compression Compression) Option {
+	return func(c *localCache) {
+		c.compression = compression
+	}
+}
+
+// WithPersistence load the snapshot at path when cache is created, save snapshot to path
+// every interval and when cache is closed. interval <= 0 means only save when closed.
+func WithPersistence(path string, interval time.Duration) Option {
+	return func(c *localCache) {
+		c.persistPath = path
+		c.persistInterval = interval
+	}
+}
+
+// WithDiskTier keep the keys evicted from memory in segment files in dir of at most capacity bytes,
+// they are promoted back to memory by Get. Segment files in dir are removed when cache is created and closed,
+// keys on disk are not saved by Save. Values are written as encoded by codec, or compressed WithCompression.
+func WithDiskTier(dir string, capacity int64) Option {
+	return func(c *localCache) {
+		c.diskDir = dir
+		c.diskCapacity = capacity
+	}
+}
+
+// WithBackingStore set the store which misses read through and Set and Del propagate to.
+// writeMode is WriteThrough or WriteBehind. Keys read from store are set with the global ttl.
+// Expiration, eviction, DelPrefix, DelMatch, InvalidateTag and Flush only change the cache.
+func WithBackingStore(store Store, writeMode string) Option {
+	return func(c *localCache) {
+		c.store = store
+		c.storeWriteMode = writeMode
+	}
+}
+
+// WithErrorHandler set the func to handle errors of background jobs like persistence, default log them
+func WithErrorHandler(onError func(err error)) Option {
+	return func(c *localCache) {
+		if onError != nil {
+			c.onError = onError
+		}
+	}
+}
+
+// WithWriteBufferPolicy set what to do when the write buffer opChan is full, default WriteBufferBlock.
+// DropOldest and ApplyInline wait timeout for space before they take effect.
+func WithWriteBufferPolicy(policy string, timeout time.Duration) Option {
+	if timeout < 0 {
+		timeout = 0
+	}
+	return func(c *localCache) {
+		c.writeBufferPolicy = policy
+		c.writeBufferTimeout = timeout
+	}
+}
+
 // WithStatist set whether need to caculate the cache`s statist, default false.
 //  not need may led performance a very little better ^-^
 func WithStatist(needStatistic bool) Option {
@@ -148,6 +423,63 @@ func WithStatist(needStatistic bool) Option {
 }
 
 func (l *localCache) Get(key string) (interface{}, bool) {
+	if l.isClosed() {
+		return nil, false
+	}
+	if value, has := l.getLocal(key); has {
+		l.statist.hitIncr()
+		return value, true
+	}
+	// not exists or expired
+	l.statist.missIncr()
+	// read through backing store
+	if l.store != nil {
+		return l.readThrough(key)
+	}
+	return nil, false
+}
+
+// Peek get a key from memory and disk tier, the policy, stats and backing store are not touched
+func (l *localCache) Peek(key string) (interface{}, bool) {
+	if l.isClosed() {
+		return nil, false
+	}
+	var value interface{}
+	if obj, has := l.dict.Get(key); has {
+		element := l.policy.unpack(obj)
+		element.lock.RLock()
+		value = element.value
+		isExpire := element.isExpire()
+		element.lock.RUnlock()
+		if isExpire {
+			return nil, false
+		}
+	} else if l.disk != nil {
+		data, expireTime, has, err := l.disk.Get(key)
+		if err != nil {
+			l.onError(err)
+			return nil, false
+		}
+		if !has || time.Now().Unix() > expireTime {
+			return nil, false
+		}
+		if value, err = l.memoryValue(data); err != nil {
+			l.onError(err)
+			return nil, false
+		}
+	} else {
+		return nil, false
+	}
+	value, err := l.decodeValue(value)
+	if err != nil {
+		l.onError(err)
+		return nil, false
+	}
+	return value, true
+}
+
+// getLocal get key from memory and disk tier without read through
+func (l *localCache) getLocal(key string) (interface{}, bool) {
 	obj, has := l.dict.Get(key)
 	if has {
 		element := l.policy.unpack(obj)
@@ -156,23 +488,30 @@ func (l *localCache) Get(key string) (interface{}, bool) {
 		isExpire := element.isExpire()
 		element.lock.RUnlock()
 		if !isExpire {
-			// add hit count, if chan full, skip this signal is ok
-			select {
-			case l.hitChan <- obj:
-			default:
+			if value, err := l.decodeValue(value); err == nil {
+				l.hit(key, obj)
+				return value, true
+			} else {
+				l.onError(err)
 			}
-			l.statist.hitIncr()
-			return value, true
 		} else {
-			l.Del(key)
+			l.expire(key)
+		}
+	}
+	// not in memory, try disk tier
+	if l.disk != nil {
+		if value, has := l.promote(key); has {
+			l.statist.diskHitIncr()
+			return value, true
 		}
 	}
-	// not exists or expired
-	l.statist.missIncr()
 	return nil, false
 }
 
 func (l *localCache) GetOrLoad(key string, f LoadFunc) (interface{}, error) {
+	if l.isClosed() {
+		return nil, ErrClosed
+	}
 	res, has := l.Get(key)
 	if has {
 		return res, nil
@@ -186,142 +525,781 @@ func (l *localCache) Set(key string, value interface{}) {
 }
 
 func (l *localCache) SetWithExpire(key string, value interface{}, ttl int64) {
-	obj, has := l.dict.Get(key)
+	l.SetWithTags(key, value, ttl)
+}
+
+// SetWithTags set a key-value and replace the tags of key, write it to backing store if need
+func (l *localCache) SetWithTags(key string, value interface{}, ttl int64, tags ...string) {
+	if l.isClosed() {
+		return
+	}
+	if l.store != nil && !l.writeStore(key, value) {
+		return
+	}
+	l.setWithTags(key, value, ttl, tags...)
+}
+
+// setWithTags set a key-value to cache only
+func (l *localCache) setWithTags(key string, value interface{}, ttl int64, tags ...string) {
+	l.setWithMeta(key, value, ttl, tags, entryMeta{})
+}
+
+// setWithMeta set a key-value of priority and pinned to cache only
+func (l *localCache) setWithMeta(key string, value interface{}, ttl int64, tags []string, meta entryMeta) {
+	if l.isClosed() {
+		return
+	}
+	if l.compression != nil {
+		data, err := l.encodeValue(value)
+		if err != nil {
+			// can not store the value, the key is not cached
+			l.onError(err)
+			l.delete(key)
+			return
+		}
+		value = data
+	}
+	l.statist.setIncr()
 	expireTime := time.Now().Add(time.Duration(ttl) * time.Second).Unix()
-	if has {
+	weight := l.weigh(key, value)
+	l.keyLock.Lock(key)
+	l.setLocked(key, value, weight, expireTime, tags, meta)
+}
+
+// setLocked set key-value to dict and indexes, must be called with keyLock of key, which is unlocked after set
+func (l *localCache) setLocked(key string, value interface{}, weight, expireTime int64, tags []string, meta entryMeta) {
+	if l.disk != nil {
+		// the value in memory is newer
+		l.disk.Del(key)
+	}
+	objOld, has := l.dict.Get(key)
+	// weight and meta of element never change, so policy can read them without lock
+	if has && l.policy.unpack(objOld).weight == weight && l.policy.unpack(objOld).entryMeta == meta {
 		// update element info
+		obj := objOld
 		element := l.policy.unpack(obj)
 		element.lock.Lock()
 		element.value = value
 		element.expireTime = expireTime
-		// set ttl surround by lock
-		l.ttlDict.Set(key, expireTime)
+		element.version = atomic.AddUint64(&l.version, 1)
+		// set tags surround by lock
+		l.tagIndex.remove(key, element.tags)
+		element.tags = tags
+		l.tagIndex.add(key, tags)
 		element.lock.Unlock()
-		// add hit count, if chan full, skip this signal is ok
-		select {
-		case l.hitChan <- obj:
-		default:
-		}
+		l.keyLock.Unlock(key)
+		l.hit(key, obj)
+		return
+	}
+	if has {
+		// weight or meta changed, replace the element so that policy charge the new weight
+		l.remove(key, objOld)
+	}
+	ns := l.namespaces.of(key)
+	if meta.pinned && !l.pin(ns, weight) {
+		// too many pinned keys, keep it as a normal key
+		meta.pinned = false
+	}
+	element := &element{
+		key:        key,
+		value:      value,
+		expireTime: expireTime,
+		tags:       tags,
+		weight:     weight,
+		version:    atomic.AddUint64(&l.version, 1),
+		ns:         ns,
+		entryMeta:  meta,
+	}
+	// set to dict sync so that Get can see it at once
+	obj := l.policy.pack(element)
+	l.dict.Set(key, obj)
+	atomic.AddInt64(&l.weight, weight)
+	element.ns.add(1, weight)
+	if l.prefixIndex != nil {
+		l.prefixIndex.Insert(key)
+	}
+	l.tagIndex.add(key, tags)
+	if has {
+		l.unlockAndApply(key, opMsg{opType: opTypeDel, obj: objOld}, opMsg{opType: opTypeAdd, obj: obj})
 	} else {
-		element := &element{
-			key:        key,
-			value:      value,
-			expireTime: expireTime,
+		l.unlockAndApply(key, opMsg{opType: opTypeAdd, obj: obj})
+	}
+}
+
+// Del delete key and return if the key exists
+func (l *localCache) Del(key string) bool {
+	_, has := l.GetAndDelete(key)
+	return has
+}
+
+// Invalidate delete key from cache only
+func (l *localCache) Invalidate(key string) bool {
+	_, has := l.delete(key)
+	return has
+}
+
+// GetAndDelete get a key and delete it, only one caller can get the value of a key.
+// The key is deleted from backing store too.
+func (l *localCache) GetAndDelete(key string) (interface{}, bool) {
+	if l.isClosed() {
+		return nil, false
+	}
+	if l.store != nil {
+		l.deleteStore(key)
+	}
+	return l.delete(key)
+}
+
+// delete get a key and delete it from cache only
+func (l *localCache) delete(key string) (interface{}, bool) {
+	if l.isClosed() {
+		return nil, false
+	}
+	if l.hotKeys != nil {
+		// a deleted key is not reported by TopKeys
+		l.hotKeys.Remove(key)
+	}
+	l.keyLock.Lock(key)
+	obj, has := l.dict.Get(key)
+	if !has {
+		if l.disk != nil {
+			return l.takeDisk(key)
 		}
-		// add async by chan
-		obj = l.policy.pack(element)
-		l.opChan <- opMsg{opType: opTypeAdd, obj: obj}
+		l.keyLock.Unlock(key)
+		return nil, false
 	}
+	l.remove(key, obj)
+	l.unlockAndApply(key, opMsg{opType: opTypeDel, obj: obj})
+	l.statist.delIncr()
+
+	element := l.policy.unpack(obj)
+	element.lock.RLock()
+	value := element.value
+	isExpire := element.isExpire()
+	element.lock.RUnlock()
+	if isExpire {
+		return nil, false
+	}
+	value, err := l.decodeValue(value)
+	if err != nil {
+		l.onError(err)
+		return nil, false
+	}
+	return value, true
 }
 
-// Del delete key
-func (l *localCache) Del(key string) {
-	// del async by chan
-	l.opChan <- opMsg{opType: opTypeDel, obj: key}
+// DelPrefix delete all keys start with prefix from cache only
+func (l *localCache) DelPrefix(prefix string) int {
+	var count int
+	for _, key := range l.prefixKeys(prefix) {
+		if l.Invalidate(key) {
+			count++
+		}
+	}
+	for _, key := range l.diskKeys(func(key string, _ []string) bool { return strings.HasPrefix(key, prefix) }) {
+		if l.Invalidate(key) {
+			count++
+		}
+	}
+	return count
 }
 
-// Len return count of keys in cache
+// DelMatch delete all keys match the glob pattern from cache only
+func (l *localCache) DelMatch(pattern string) int {
+	var count int
+	for _, key := range l.matchKeys(pattern) {
+		if l.Invalidate(key) {
+			count++
+		}
+	}
+	for _, key := range l.diskKeys(func(key string, _ []string) bool { return common.MatchGlob(pattern, key) }) {
+		if l.Invalidate(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// InvalidateTag delete all keys associated with tag
+func (l *localCache) InvalidateTag(tag string) int {
+	var count int
+	for _, key := range l.tagIndex.keys(tag) {
+		if _, has := l.delete(key); has {
+			count++
+		}
+	}
+	for _, key := range l.diskKeys(func(_ string, tags []string) bool { return hasTag(tags, tag) }) {
+		if _, has := l.delete(key); has {
+			count++
+		}
+	}
+	return count
+}
+
+// TTL return the remaining time to live of key
+func (l *localCache) TTL(key string) (time.Duration, bool) {
+	if l.isClosed() {
+		return 0, false
+	}
+	var expireTime int64
+	if obj, has := l.dict.Get(key); has {
+		element := l.policy.unpack(obj)
+		element.lock.RLock()
+		expireTime = element.expireTime
+		element.lock.RUnlock()
+	} else if l.disk != nil {
+		if expireTime, has = l.disk.ExpireTime(key); !has {
+			return 0, false
+		}
+	} else {
+		return 0, false
+	}
+	if time.Now().Unix() > expireTime {
+		return 0, false
+	}
+	return time.Until(time.Unix(expireTime, 0)), true
+}
+
+// Touch set seconds to live of key without changing its value and version, a key in disk tier is promoted first
+func (l *localCache) Touch(key string, ttl int64) bool {
+	if l.isClosed() {
+		return false
+	}
+	if _, has := l.dict.Get(key); !has && l.disk != nil {
+		l.promote(key)
+	}
+	l.keyLock.Lock(key)
+	defer l.keyLock.Unlock(key)
+	obj, has := l.dict.Get(key)
+	if !has {
+		return false
+	}
+	element := l.policy.unpack(obj)
+	element.lock.Lock()
+	defer element.lock.Unlock()
+	if element.isExpire() {
+		return false
+	}
+	element.expireTime = time.Now().Add(time.Duration(ttl) * time.Second).Unix()
+	return true
+}
+
+// Keys return all keys not expired in cache
+func (l *localCache) Keys() []string {
+	if l.isClosed() {
+		return nil
+	}
+	keys := make([]string, 0, l.Len())
+	l.dict.Range(func(key string, obj interface{}) bool {
+		element := l.policy.unpack(obj)
+		element.lock.RLock()
+		isExpire := element.isExpire()
+		element.lock.RUnlock()
+		if !isExpire {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return append(keys, l.diskKeys(func(string, []string) bool { return true })...)
+}
+
+// Len return count of keys in cache, include keys in disk tier
 func (l *localCache) Len() int {
+	if l.disk != nil {
+		return l.dict.Len() + l.disk.Len()
+	}
 	return l.dict.Len()
 }
 
-// Flush clear all keys in cache
+// Flush clear all keys in cache, it is done by cacheProcess and wait until finished
 func (l *localCache) Flush() {
-	l.dict.Flush()
-	l.Stop()
-
-	l.hitChan = make(chan interface{}, hitChanLen)
-	l.opChan = make(chan opMsg, addChanLen)
-	l.policy.flush()
+	done := make(chan struct{})
+	if l.send(opMsg{opType: opTypeFlush, done: done}) {
+		<-done
+	}
+}
 
-	l.start()
+// Close drain the ops in queue and wait background goroutines exit
+func (l *localCache) Close(ctx context.Context) error {
+	l.closeOnce.Do(func() {
+		// wait senders who hold closeLock, no one can send to opChan after this
+		l.closeLock.Lock()
+		atomic.StoreInt32(&l.closed, 1)
+		l.closeLock.Unlock()
+		close(l.stopChan)
+		go func() {
+			l.wg.Wait()
+			// all ops are drained, do the final save
+			if l.persistPath != "" {
+				if err := l.persist(); err != nil {
+					l.onError(err)
+				}
+			}
+			if l.disk != nil {
+				if err := l.disk.Close(); err != nil {
+					l.onError(err)
+				}
+			}
+			close(l.doneChan)
+		}()
+	})
+	select {
+	case <-l.doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// Stop the cacheProcess by close stopChan
+// Stop the cache, same as Close without timeout
 func (l *localCache) Stop() {
-	close(l.stopChan)
+	_ = l.Close(context.Background())
 }
 
 func (l *localCache) Statistic() map[string]interface{} {
+	var stats Stats
+	l.statist.fill(&stats)
 	return map[string]interface{}{
 		"hit":     l.statist.GetHitCount(),
 		"miss":    l.statist.GetMissCount(),
 		"hitRate": l.statist.GetHitRate(),
+		// count of writes which find the write buffer full
+		"backpressure": l.statist.GetBackpressureCount(),
+		// count of hits dropped by read buffer, policy does not see them
+		"droppedHits": l.readBuf.droppedCount(),
+		// hit rate of the last minutes
+		"hitRate1m":  stats.Last1m.HitRate(),
+		"hitRate5m":  stats.Last5m.HitRate(),
+		"hitRate15m": stats.Last15m.HitRate(),
+	}
+}
+
+// TopKeys return at most k hottest keys, nil if not WithHotKeys
+func (l *localCache) TopKeys(k int) []KeyCount {
+	if l.hotKeys == nil {
+		return nil
+	}
+	items := l.hotKeys.List(k)
+	keys := make([]KeyCount, len(items))
+	for i, item := range items {
+		keys[i] = KeyCount{Key: item.Key, Count: uint64(item.Count)}
+	}
+	return keys
+}
+
+// Stats return a typed snapshot of cache statistic
+func (l *localCache) Stats() Stats {
+	var stats Stats
+	l.statist.fill(&stats)
+	stats.DroppedHits = l.readBuf.droppedCount()
+	stats.Entries = l.dict.Len()
+	if l.disk != nil {
+		stats.DiskEntries = l.disk.Len()
+		stats.DiskBytes = l.disk.Size()
 	}
+	stats.Weight = atomic.LoadInt64(&l.weight)
+	stats.PinnedWeight = atomic.LoadInt64(&l.pinnedWeight)
+	stats.QueueDepth = len(l.opChan)
+	return stats
 }
 
 // start cacheProcess
 func (l *localCache) start() {
-	l.stopChan = make(chan struct{})
+	l.wg.Add(1)
 	// deal chan signals
 	go l.cacheProcess()
-	//  delete the keys which are expired
-	go l.ttlProcess()
+	//  delete the keys which are expired, Manager calls expireTick of its caches by one ticker
+	if !l.sharedTicker {
+		l.wg.Add(1)
+		go l.ttlProcess()
+	}
+	// write dirty keys to backing store
+	if l.writeBehindQueue != nil {
+		l.wg.Add(1)
+		go l.writeBehindProcess()
+	}
+	// expire and compact disk tier
+	if l.disk != nil {
+		l.wg.Add(1)
+		go l.diskProcess()
+	}
+	// save snapshot periodically
+	if l.persistPath != "" && l.persistInterval > 0 {
+		l.wg.Add(1)
+		go l.persistProcess()
+	}
+}
+
+// defaultOnError log errors of background jobs
+func defaultOnError(err error) {
+	log.Printf("localcache: %v", err)
+}
+
+// hit record a hit of obj to policy
+func (l *localCache) hit(key string, obj interface{}) {
+	if l.shardPolicies != nil && !l.inQuota(obj) {
+		l.keyLock.Lock(key)
+		l.shardPolicy(key).hit(obj)
+		l.keyLock.Unlock(key)
+		if l.hotKeys != nil {
+			l.hotKeys.Add(key)
+		}
+		return
+	}
+	// if buffer busy, skip this signal is ok
+	l.readBuf.push(obj)
+}
+
+// unlockAndApply apply add or del msgs to policy and unlock key.
+// In sharded mode the shard policy is updated before unlock, else msgs are sent to cacheProcess after unlock.
+func (l *localCache) unlockAndApply(key string, msgs ...opMsg) {
+	if l.shardPolicies == nil {
+		l.keyLock.Unlock(key)
+		for _, msg := range msgs {
+			l.send(msg)
+		}
+		return
+	}
+	p := l.shardPolicy(key)
+	var queued []opMsg
+	for _, msg := range msgs {
+		if l.inQuota(msg.obj) {
+			// policy of namespace is updated by cacheProcess
+			queued = append(queued, msg)
+		} else if msg.opType == opTypeAdd {
+			p.add(msg.obj)
+			if atomic.LoadInt32(&l.namespaces.quota) == 1 {
+				// keys of namespaces with quota are not in shard policies but counted by capacity
+				for atomic.LoadInt64(&l.weight) > int64(l.cap) && p.evictOne() {
+				}
+			}
+		} else {
+			p.del(msg.obj)
+		}
+	}
+	l.keyLock.Unlock(key)
+	for _, msg := range queued {
+		l.send(msg)
+	}
+}
+
+// weigh return weight of key-value, 1 if no weigher
+func (l *localCache) weigh(key string, value interface{}) int64 {
+	if l.weigher == nil {
+		return 1
+	}
+	return l.weigher(key, value)
+}
+
+// shardPolicy return the policy of the shard which key belongs to
+func (l *localCache) shardPolicy(key string) policy {
+	return l.shardPolicies[common.GetShardIndex(key, uint32(l.shardCnt))]
+}
+
+// isClosed return whether Close is called
+func (l *localCache) isClosed() bool {
+	return atomic.LoadInt32(&l.closed) == 1
+}
+
+// send msg to opChan, return false if cache is closed
+func (l *localCache) send(msg opMsg) bool {
+	l.closeLock.RLock()
+	defer l.closeLock.RUnlock()
+	if l.isClosed() {
+		return false
+	}
+	select {
+	case l.opChan <- msg:
+		return true
+	default:
+	}
+	// opChan is full
+	l.statist.backpressureIncr()
+	// flush and sync must be done by order, so always wait
+	if msg.opType == opTypeFlush || msg.opType == opTypeSync {
+		l.opChan <- msg
+		return true
+	}
+	switch l.writeBufferPolicy {
+	case WriteBufferDropOldest:
+		if l.sendTimeout(msg) {
+			return true
+		}
+		for {
+			select {
+			case l.opChan <- msg:
+				return true
+			case old := <-l.opChan:
+				l.dropOp(old)
+			}
+		}
+	case WriteBufferApplyInline:
+		if !l.sendTimeout(msg) {
+			l.doOp(msg)
+		}
+	default:
+		l.opChan <- msg
+	}
+	return true
+}
+
+// sendTimeout wait writeBufferTimeout to send msg, return false if timeout
+func (l *localCache) sendTimeout(msg opMsg) bool {
+	if l.writeBufferTimeout <= 0 {
+		return false
+	}
+	t := time.NewTimer(l.writeBufferTimeout)
+	defer t.Stop()
+	select {
+	case l.opChan <- msg:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// dropOp drop an op msg taken from opChan
+func (l *localCache) dropOp(opMsg opMsg) {
+	switch opMsg.opType {
+	case opTypeAdd:
+		// undo the set, the key will not be cached
+		if l.removeObj(opMsg.obj, false) {
+			l.statist.evictIncr(evictByWriteBuffer)
+			l.policy.unpack(opMsg.obj).ns.evictIncr(evictByWriteBuffer)
+		}
+	case opTypeFlush, opTypeSync:
+		// flush and sync can not be dropped
+		l.doOp(opMsg)
+	}
 }
 
 // cacheProcess run a loop to deal chan signals
 //  use a single goroutine to make policy ops safe.
 func (l *localCache) cacheProcess() {
+	defer l.wg.Done()
 	for {
 		select {
-		case obj := <-l.hitChan:
-			l.policy.hit(obj)
+		case <-l.readBuf.signal:
+			l.policyLock.Lock()
+			l.readBuf.drain(l.drainHit)
+			l.policyLock.Unlock()
 		case opMsg := <-l.opChan:
-			if opMsg.opType == opTypeAdd {
-				l.set(opMsg.obj)
-			} else if opMsg.opType == opTypeDel {
-				l.del(opMsg.obj.(string))
-			}
+			l.doOp(opMsg)
 		case <-l.stopChan:
-			return
+			// no one send to opChan after stop, drain the ops left
+			for {
+				select {
+				case opMsg := <-l.opChan:
+					l.doOp(opMsg)
+				default:
+					return
+				}
+			}
 		}
 	}
 }
 
+// drainHit called by cacheProcess with policyLock for every hit in read buffer
+func (l *localCache) drainHit(obj interface{}) {
+	l.policyOf(obj).hit(obj)
+	if l.hotKeys != nil {
+		// a hit of a key deleted before drained is not added back to hot keys
+		key := l.policy.unpack(obj).key
+		if objNow, has := l.dict.Get(key); has && objNow == obj {
+			l.hotKeys.Add(key)
+		}
+	}
+}
+
+// doOp do an op msg, called by cacheProcess() or the writer when opChan is full
+func (l *localCache) doOp(opMsg opMsg) {
+	l.policyLock.Lock()
+	defer l.policyLock.Unlock()
+	switch opMsg.opType {
+	case opTypeAdd:
+		l.set(opMsg.obj)
+	case opTypeDel:
+		l.policyOf(opMsg.obj).del(opMsg.obj)
+	case opTypeFlush:
+		l.flush()
+		close(opMsg.done)
+	case opTypeSync:
+		close(opMsg.done)
+	}
+}
+
 // load use singleFlight to load and set cache
 func (l *localCache) load(key string, f LoadFunc) (interface{}, error) {
 	loadF := func() (interface{}, error) {
+		start := time.Now()
 		res, err := f()
+		l.statist.loadIncr(time.Since(start), err)
 		// if no err, set k-v to cache
 		if err == nil {
-			l.Set(key, res)
+			l.setWithTags(key, res, l.ttl)
 		}
 		return res, err
 	}
 	// use singleFlight to load and set cache
-	return l.group.Do(key, loadF)
+	res, err, shared := l.group.DoShared(key, loadF)
+	if shared {
+		l.statist.sharedLoadIncr()
+	}
+	return res, err
 }
 
-// set called by single goroutine cacheProcess() to sync call
+// set called by doOp with policyLock
 func (l *localCache) set(obj interface{}) {
 	ele := l.policy.unpack(obj)
-	objOld, has := l.dict.Get(ele.key)
-	if has { // exists, del objOld from lru list
-		l.policy.del(objOld)
+	// the key may be deleted or set again before we add it to policy, skip the dead obj
+	if objNow, has := l.dict.Get(ele.key); !has || objNow != obj {
+		return
+	}
+	p := l.policyOf(obj)
+	p.add(obj)
+	l.fitCapacity(p)
+}
+
+// flush called by doOp with policyLock to clear all keys,
+// lock all keys so that set and del wait until dict and indexes are all cleared.
+func (l *localCache) flush() {
+	l.keyLock.LockAll()
+	l.dict.Flush()
+	if l.prefixIndex != nil {
+		l.prefixIndex.Flush()
+	}
+	l.tagIndex.flush()
+	atomic.StoreInt64(&l.weight, 0)
+	atomic.StoreInt64(&l.pinnedWeight, 0)
+	if l.disk != nil {
+		if err := l.disk.Reset(); err != nil {
+			l.onError(err)
+		}
+	}
+	l.policy.flush()
+	for _, p := range l.shardPolicies {
+		p.flush()
+	}
+	l.namespaces.flush()
+	if l.hotKeys != nil {
+		l.hotKeys.Reset()
+	}
+	l.keyLock.UnlockAll()
+}
+
+// evict called by policy when an obj is removed from policy to free space,
+// del the key if the obj is still in dict.
+func (l *localCache) evict(obj interface{}) {
+	if l.removeObj(obj, true) {
+		l.statist.evictIncr(evictByCapacity)
+		l.policy.unpack(obj).ns.evictIncr(evictByCapacity)
+	}
+}
+
+// removeObj del the key if the obj is still in dict, return if deleted. spill the obj to disk tier if need.
+func (l *localCache) removeObj(obj interface{}, spill bool) bool {
+	key := l.policy.unpack(obj).key
+	l.keyLock.Lock(key)
+	objNow, has := l.dict.Get(key)
+	has = has && objNow == obj
+	if has {
+		if spill {
+			l.spill(key, obj)
+		}
+		l.remove(key, obj)
 	}
-	l.dict.Set(ele.key, obj)
-	// set ttl
-	l.ttlDict.Set(ele.key, ele.expireTime)
-	// add policy
-	l.policy.add(obj)
+	l.keyLock.Unlock(key)
+	return has
 }
 
-// del called by single goroutine cacheProcess() to sync call
-func (l *localCache) del(key string) {
+// evictLocked called by shard policy when an obj is removed to free space,
+// the keyLock of shard is held by the caller who add obj to the shard policy.
+func (l *localCache) evictLocked(obj interface{}) {
+	key := l.policy.unpack(obj).key
+	if objNow, has := l.dict.Get(key); has && objNow == obj {
+		l.spill(key, obj)
+		l.remove(key, obj)
+		l.statist.evictIncr(evictByCapacity)
+		l.policy.unpack(obj).ns.evictIncr(evictByCapacity)
+	}
+}
+
+// expire del the key if it is expired
+func (l *localCache) expire(key string) {
+	l.keyLock.Lock(key)
 	obj, has := l.dict.Get(key)
 	if !has {
+		l.keyLock.Unlock(key)
 		return
 	}
-	// need del
+	element := l.policy.unpack(obj)
+	element.lock.RLock()
+	isExpire := element.isExpire()
+	element.lock.RUnlock()
+	if !isExpire {
+		// set again before we lock it
+		l.keyLock.Unlock(key)
+		return
+	}
+	l.remove(key, obj)
+	l.unlockAndApply(key, opMsg{opType: opTypeDel, obj: obj})
+	l.statist.expireIncr()
+	element.ns.expireIncr()
+}
+
+// remove del key from dict and indexes, must be called with keyLock of key
+func (l *localCache) remove(key string, obj interface{}) {
 	l.dict.Del(key)
-	// del ttl
-	l.ttlDict.Del(key)
-	// del policy list
-	l.policy.del(obj)
+	atomic.AddInt64(&l.weight, -l.policy.unpack(obj).weight)
+	l.policy.unpack(obj).ns.add(-1, -l.policy.unpack(obj).weight)
+	if l.policy.unpack(obj).pinned {
+		atomic.AddInt64(&l.pinnedWeight, -l.policy.unpack(obj).weight)
+		l.policy.unpack(obj).ns.unpin(l.policy.unpack(obj).weight)
+	}
+	if l.prefixIndex != nil {
+		l.prefixIndex.Delete(key)
+	}
+	// del tags
+	ele := l.policy.unpack(obj)
+	ele.lock.Lock()
+	l.tagIndex.remove(key, ele.tags)
+	ele.tags = nil
+	ele.lock.Unlock()
+}
+
+// prefixKeys return keys start with prefix, use prefix index if enable, else scan all shards
+func (l *localCache) prefixKeys(prefix string) []string {
+	if l.prefixIndex != nil {
+		return l.prefixIndex.PrefixKeys(prefix)
+	}
+	var keys []string
+	l.dict.Range(func(key string, _ interface{}) bool {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// matchKeys return keys match the glob pattern, use prefix index if enable, else scan all shards
+func (l *localCache) matchKeys(pattern string) []string {
+	if l.prefixIndex != nil {
+		return l.prefixIndex.Match(pattern)
+	}
+	var keys []string
+	l.dict.Range(func(key string, _ interface{}) bool {
+		if common.MatchGlob(pattern, key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
 }
 
 // ttlProcess run a loop to delete the keys which are expired
 func (l *localCache) ttlProcess() {
+	defer l.wg.Done()
 	t := time.NewTicker(defaultTTLTick * time.Millisecond)
 	defer t.Stop()
 	for {
@@ -329,35 +1307,42 @@ func (l *localCache) ttlProcess() {
 		case <-l.stopChan:
 			return
 		case <-t.C:
-			ti := time.Now()
-			var delCount = 100
-			// every 100ms, check rand 100 keys;
-			// if expired more than 25, check again; like redis.
-			// max run 50 ms.
-			for delCount > defaultTTLCheckPercent &&
-				time.Now().Sub(ti) < defaultTTLCheckRunTime*time.Millisecond {
-				delCount = 0
-				now := time.Now().Unix()
-				keys := l.dict.RandKeys(defaultTTLCheckCount)
-				distinctMap := make(map[string]struct{}, defaultTTLCheckCount)
-				for _, key := range keys {
-					if _, see := distinctMap[key]; see {
-						continue
-					}
-					// add distinct key in map because RandKeys may repeat
-					distinctMap[key] = struct{}{}
-					v, has := l.ttlDict.Get(key)
-					if has {
-						// key expired, del it from dict & ttl dict
-						expireTime := v.(int64)
-						if now > expireTime {
-							l.Del(key)
-							delCount++
-						}
-					}
+			l.expireTick()
+		}
+	}
+}
+
+// expireTick delete the keys which are expired, it is called every tick by ttlProcess or the ticker of Manager
+func (l *localCache) expireTick() {
+	ti := time.Now()
+	var delCount = 100
+	// every 100ms, check rand 100 keys;
+	// if expired more than 25, check again; like redis.
+	// max run 50 ms.
+	for delCount > defaultTTLCheckPercent &&
+		time.Now().Sub(ti) < defaultTTLCheckRunTime*time.Millisecond {
+		delCount = 0
+		now := time.Now().Unix()
+		keys := l.dict.RandKeys(defaultTTLCheckCount)
+		distinctMap := make(map[string]struct{}, defaultTTLCheckCount)
+		for _, key := range keys {
+			if _, see := distinctMap[key]; see {
+				continue
+			}
+			// add distinct key in map because RandKeys may repeat
+			distinctMap[key] = struct{}{}
+			obj, has := l.dict.Get(key)
+			if has {
+				element := l.policy.unpack(obj)
+				element.lock.RLock()
+				expireTime := element.expireTime
+				element.lock.RUnlock()
+				// key expired, del it from dict
+				if now > expireTime {
+					l.expire(key)
+					delCount++
 				}
 			}
-			//fmt.Println(time.Now(), time.Now().Sub(ti), l.ttlDict.Len(), l.Len())
 		}
 	}
 }
@@ -368,6 +1353,11 @@ type element struct {
 	key        string       // need key to del in policy when list is full
 	value      interface{}
 	expireTime int64
+	tags       []string   // tags associated with key
+	weight     int64      // never change after created
+	version    uint64     // changed by every set
+	ns         *namespace // namespace of key, nil if not in a namespace
+	entryMeta             // never change after created
 }
 
 // isExpire return whether key is dead
@@ -377,6 +1367,7 @@ func (e *element) isExpire() bool {
 
 // opMsg is a msg send to opChan when add or del a key
 type opMsg struct {
-	opType uint8       // type: add || del
-	obj    interface{} // policy`s obj when set || key string when del
+	opType uint8         // type: add || del || flush || sync
+	obj    interface{}   // policy`s obj
+	done   chan struct{} // closed when flush or sync is done
 }
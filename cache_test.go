@@ -1,6 +1,8 @@
 package localcache
 
 import (
+	"context"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -65,12 +67,40 @@ func TestDel(t *testing.T) {
 	c := NewLocalCache()
 	defer c.Stop()
 	c.Set("123", 1)
-	c.Del("123")
-	time.Sleep(1 * time.Millisecond)
+	if !c.Del("123") {
+		t.Error("TestDel1 not exists")
+	}
 	_, has := c.Get("123")
 	if has {
 		t.Error("TestDel2 not exists")
 	}
+	if c.Del("123") {
+		t.Error("TestDel3 exists")
+	}
+}
+
+func TestGetAndDelete(t *testing.T) {
+	c := NewLocalCache()
+	defer c.Stop()
+	c.Set("token", "otp")
+	var wg sync.WaitGroup
+	var getCnt int32
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, has := c.GetAndDelete("token"); has && v.(string) == "otp" {
+				atomic.AddInt32(&getCnt, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if getCnt != 1 {
+		t.Errorf("TestGetAndDelete1 get %d times <> 1", getCnt)
+	}
+	if _, has := c.Get("token"); has {
+		t.Error("TestGetAndDelete2 exists")
+	}
 }
 
 func TestLen(t *testing.T) {
@@ -103,3 +133,159 @@ func TestFlush(t *testing.T) {
 		t.Error("TestFlush2 <> 0")
 	}
 }
+
+func TestDelPrefix(t *testing.T) {
+	for _, needIndex := range []bool{false, true} {
+		c := NewLocalCache(WithPrefixIndex(needIndex))
+		c.Set("tenant:42:a", 1)
+		c.Set("tenant:42:b", 2)
+		c.Set("tenant:421:a", 3)
+		waitFor(t, func() bool { return c.Len() == 3 })
+		if n := c.DelPrefix("tenant:42:"); n != 2 {
+			t.Errorf("TestDelPrefix1 index=%v deleted %d <> 2", needIndex, n)
+		}
+		waitFor(t, func() bool { return c.Len() == 1 })
+		if _, has := c.Get("tenant:42:a"); has {
+			t.Errorf("TestDelPrefix2 index=%v tenant:42:a exists", needIndex)
+		}
+		if _, has := c.Get("tenant:421:a"); !has {
+			t.Errorf("TestDelPrefix3 index=%v tenant:421:a not exists", needIndex)
+		}
+		c.Stop()
+	}
+}
+
+func TestDelMatch(t *testing.T) {
+	for _, needIndex := range []bool{false, true} {
+		c := NewLocalCache(WithPrefixIndex(needIndex))
+		c.Set("tenant:1:user", 1)
+		c.Set("tenant:2:user", 2)
+		c.Set("tenant:2:order", 3)
+		waitFor(t, func() bool { return c.Len() == 3 })
+		if n := c.DelMatch("tenant:*:user"); n != 2 {
+			t.Errorf("TestDelMatch1 index=%v deleted %d <> 2", needIndex, n)
+		}
+		waitFor(t, func() bool { return c.Len() == 1 })
+		if c.Len() != 1 {
+			t.Errorf("TestDelMatch2 index=%v len %d <> 1", needIndex, c.Len())
+		}
+		if _, has := c.Get("tenant:2:order"); !has {
+			t.Errorf("TestDelMatch3 index=%v tenant:2:order not exists", needIndex)
+		}
+		c.Stop()
+	}
+}
+
+// waitFor poll cond until it is true, the keys are set and deleted by cacheProcess async
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("waitFor timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlushConcurrent(t *testing.T) {
+	c := NewLocalCache(WithCapacity(100000))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa(i*1000 + j)
+				c.Set(key, j)
+				if j%3 == 0 {
+					c.Del(key)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		c.Flush()
+	}
+	wg.Wait()
+	c.Stop()
+	policy := c.(*localCache).policy.(*policyLRU)
+	if policy.list.Len() != c.(*localCache).dict.Len() {
+		t.Errorf("TestFlushConcurrent list len %d <> dict len %d", policy.list.Len(), c.(*localCache).dict.Len())
+	}
+}
+
+func TestClose(t *testing.T) {
+	c := NewLocalCache()
+	for i := 0; i < 100; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Errorf("TestClose1 err=%v", err)
+	}
+	// ops in queue are drained before close
+	if l := c.(*localCache).policy.(*policyLRU).list.Len(); l != 100 {
+		t.Errorf("TestClose2 list len %d <> 100", l)
+	}
+	// close again is ok
+	if err := c.Close(context.Background()); err != nil {
+		t.Errorf("TestClose3 err=%v", err)
+	}
+	c.Stop()
+	c.Set("a", 1)
+	if _, has := c.Get("a"); has {
+		t.Error("TestClose4 set after close")
+	}
+	if _, err := c.GetOrLoad("a", func() (interface{}, error) { return 1, nil }); err != ErrClosed {
+		t.Errorf("TestClose5 err=%v", err)
+	}
+	c.Flush()
+}
+
+func TestWriteBufferPolicy(t *testing.T) {
+	for _, policy := range []string{WriteBufferDropOldest, WriteBufferApplyInline} {
+		c := NewLocalCache(WithCapacity(100000), WithWriteBufferPolicy(policy, time.Millisecond))
+		l := c.(*localCache)
+		// block cacheProcess so opChan will be full
+		l.policyLock.Lock()
+		if policy == WriteBufferApplyInline {
+			// inline writers wait policyLock too
+			time.AfterFunc(500*time.Millisecond, l.policyLock.Unlock)
+		}
+		n := addChanLen + 100
+		for i := 0; i < n; i++ {
+			c.Set(strconv.Itoa(i), i)
+		}
+		if policy == WriteBufferDropOldest {
+			l.policyLock.Unlock()
+		}
+		c.Stop()
+		if c.Statistic()["backpressure"].(uint64) == 0 {
+			t.Errorf("TestWriteBufferPolicy1 %s backpressure = 0", policy)
+		}
+		if policy == WriteBufferDropOldest && l.dict.Len() >= n {
+			t.Errorf("TestWriteBufferPolicy2 %s nothing dropped", policy)
+		}
+		if policy == WriteBufferApplyInline && l.dict.Len() != n {
+			t.Errorf("TestWriteBufferPolicy3 %s dict len %d <> %d", policy, l.dict.Len(), n)
+		}
+		if l.policy.(*policyLRU).list.Len() != l.dict.Len() {
+			t.Errorf("TestWriteBufferPolicy4 %s list len %d <> dict len %d", policy, l.policy.(*policyLRU).list.Len(), l.dict.Len())
+		}
+	}
+}
+
+func TestTTLAndKeys(t *testing.T) {
+	c := NewLocalCache()
+	defer c.Stop()
+	c.SetWithExpire("a", 1, 10)
+	c.SetWithExpire("b", 1, -1)
+	if ttl, has := c.TTL("a"); !has || ttl <= 9*time.Second || ttl > 10*time.Second {
+		t.Errorf("TestTTLAndKeys1 ttl %v %v", ttl, has)
+	}
+	if _, has := c.TTL("b"); has {
+		t.Error("TestTTLAndKeys2 b exists")
+	}
+	if keys := c.Keys(); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("TestTTLAndKeys3 keys %v", keys)
+	}
+}
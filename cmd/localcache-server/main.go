@@ -0,0 +1,65 @@
+// Command localcache-server serve a cache by the redis or memcached protocol, it runs as a sidecar for their clients.
+//
+//	localcache-server -addr :6379 -capacity 100000 -ttl 300
+//	localcache-server -protocol memcache -addr :11211
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/MoeYang/go-localcache"
+	"github.com/MoeYang/go-localcache/server/memcache"
+	"github.com/MoeYang/go-localcache/server/resp"
+)
+
+// server is resp.Server or memcache.Server
+type server interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
+func main() {
+	protocol := flag.String("protocol", "resp", "protocol to serve, resp or memcache")
+	addr := flag.String("addr", "", "address to serve, default :6379 for resp and :11211 for memcache")
+	capacity := flag.Int("capacity", 100000, "max count of keys")
+	ttl := flag.Int64("ttl", 300, "seconds to live of keys set without EX or PX")
+	flag.Parse()
+
+	cache := localcache.NewLocalCache(
+		localcache.WithCapacity(*capacity),
+		localcache.WithGlobalTTL(*ttl),
+		localcache.WithStatist(true),
+	)
+	defer cache.Stop()
+
+	var server server
+	var errClosed error
+	switch *protocol {
+	case "resp":
+		server, errClosed = resp.NewServer(cache), resp.ErrServerClosed
+		if *addr == "" {
+			*addr = ":6379"
+		}
+	case "memcache":
+		server, errClosed = memcache.NewServer(cache), memcache.ErrServerClosed
+		if *addr == "" {
+			*addr = ":11211"
+		}
+	default:
+		log.Fatalf("localcache-server: unknown protocol %q", *protocol)
+	}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		server.Close()
+	}()
+	log.Printf("localcache-server: serve %s protocol on %s", *protocol, *addr)
+	if err := server.ListenAndServe(*addr); err != nil && err != errClosed {
+		log.Fatal(err)
+	}
+}
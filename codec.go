@@ -0,0 +1,55 @@
+package localcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec encode and decode values, used to save values out of memory
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+var (
+	// GobCodec encode values by encoding/gob, the default codec.
+	// Values of user types must be registered by gob.Register.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec encode values by encoding/json, values are decoded as
+	// map[string]interface{}, []interface{}, float64, string, bool or nil.
+	JSONCodec Codec = jsonCodec{}
+)
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	// encode a pointer to interface so that gob keeps the concrete type
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
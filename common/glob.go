@@ -0,0 +1,97 @@
+package common
+
+import "strings"
+
+// MatchGlob reports whether str matches the glob pattern, like redis KEYS.
+// Supported: '*' any sequence, '?' any single byte, '[abc]' '[a-z]' '[^a]' a byte class,
+// '\' escapes the next byte. Unlike path.Match, '*' also matches '/'.
+func MatchGlob(pattern, str string) bool {
+	// only backtrack to the last '*', so it is O(len(pattern)*len(str)) for any pattern
+	starP, starS := -1, 0
+	p, s := 0, 0
+	for s < len(str) {
+		if p < len(pattern) && pattern[p] == '*' {
+			p++
+			starP, starS = p, s
+			continue
+		}
+		if p < len(pattern) {
+			if matched, next := matchByte(pattern, p, str[s]); matched {
+				p, s = next, s+1
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		// let the last '*' match one more byte
+		starS++
+		p, s = starP, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchByte match c with the pattern item at p, return if matched and the position of the next item
+func matchByte(pattern string, p int, c byte) (bool, int) {
+	switch pattern[p] {
+	case '?':
+		return true, p + 1
+	case '[':
+		matched, rest := matchClass(pattern[p+1:], c)
+		return matched, len(pattern) - len(rest)
+	case '\\':
+		if p+1 < len(pattern) {
+			p++
+		}
+	}
+	return pattern[p] == c, p + 1
+}
+
+// matchClass match c with a byte class like "a-z]", return if matched and the pattern after ']'
+func matchClass(pattern string, c byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+	var matched bool
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			if pattern[1] == c {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == c {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	// skip ']', an unclosed class consumes the rest of the pattern
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return matched != not, pattern
+}
+
+// GlobPrefix return the literal prefix of a glob pattern before the first special char,
+// every string matches the pattern starts with it.
+func GlobPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
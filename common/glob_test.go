@@ -0,0 +1,62 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"tenant:42:*", "tenant:42:user:1", true},
+		{"tenant:42:*", "tenant:421:user:1", false},
+		{"*", "", true},
+		{"a*b*c", "a/x/b/y/c", true},
+		{"a*b*c", "acb", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"*a", "ba", true},
+		{"a*", "", false},
+		{"**", "", true},
+		{`a\`, `a\`, true},
+	}
+	for i, c := range cases {
+		if MatchGlob(c.pattern, c.str) != c.match {
+			t.Errorf("TestMatchGlob%d %q %q want %v", i, c.pattern, c.str, c.match)
+		}
+	}
+}
+
+func TestMatchGlobPathological(t *testing.T) {
+	// backtracking of every '*' is exponential for this pattern
+	pattern := strings.Repeat("*a", 20) + "*b"
+	str := strings.Repeat("a", 10000)
+	start := time.Now()
+	if MatchGlob(pattern, str) {
+		t.Error("TestMatchGlobPathological1 matched")
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("TestMatchGlobPathological2 cost %v", cost)
+	}
+}
+
+func TestGlobPrefix(t *testing.T) {
+	cases := map[string]string{"user:*": "user:", "a?b": "a", "[ab]c": "", "a\\*": "a", "abc": "abc"}
+	for pattern, want := range cases {
+		if got := GlobPrefix(pattern); got != want {
+			t.Errorf("TestGlobPrefix %q = %q, want %q", pattern, got, want)
+		}
+	}
+}
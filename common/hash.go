@@ -15,3 +15,18 @@ func fnv32(key string) uint32 {
 func GetShardIndex(key string, shardCount uint32) uint32 {
 	return fnv32(key) & (shardCount - 1)
 }
+
+const (
+	offset64 = uint64(14695981039346656037)
+	prime64  = uint64(1099511628211)
+)
+
+// Hash64 return 64 bits fnv-1a hash code of key
+func Hash64(key string) uint64 {
+	hash := offset64
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	return hash
+}
@@ -22,6 +22,13 @@ type Group struct {
 // time. If a duplicate comes in, the duplicate caller waits for the
 // original to complete and receives the same results.
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	v, err, _ := g.DoShared(key, fn)
+	return v, err
+}
+
+// DoShared is like Do, and return whether the caller got the results of
+// another caller's in-flight call instead of calling fn itself.
+func (g *Group) DoShared(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	g.lock.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
@@ -29,7 +36,7 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	if c, has := g.m[key]; has {
 		g.lock.Unlock()
 		c.wg.Wait()
-		return c.val, c.err
+		return c.val, c.err, true
 	}
 	c := new(call)
 	c.wg.Add(1)
@@ -43,5 +50,5 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	delete(g.m, key)
 	g.lock.Unlock()
 
-	return c.val, c.err
+	return c.val, c.err, false
 }
@@ -53,3 +53,25 @@ func TestGroupDoMulti(t *testing.T) {
 		t.Error("TestGroupDoMulti callcnt != 1")
 	}
 }
+
+func TestGroupDoShared(t *testing.T) {
+	var g Group
+	ch := make(chan struct{})
+	res := make(chan bool, 2)
+	fn := func() (interface{}, error) {
+		<-ch
+		return "v", nil
+	}
+	for i := 1; i <= 2; i++ {
+		go func() {
+			_, _, shared := g.DoShared("k", fn)
+			res <- shared
+		}()
+	}
+	time.AfterFunc(100*time.Millisecond, func() {
+		close(ch)
+	})
+	if a, b := <-res, <-res; a == b {
+		t.Errorf("TestGroupDoShared shared %v %v", a, b)
+	}
+}
@@ -0,0 +1,126 @@
+package localcache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+)
+
+// Compression compress the encoded values stored in cache
+type Compression interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	// NoCompression store values encoded by codec without compress
+	NoCompression Compression = noCompression{}
+	// FlateCompression compress values by compress/flate with default level
+	FlateCompression Compression = newFlateCompression(flate.DefaultCompression)
+	// GzipCompression compress values by compress/gzip with default level
+	GzipCompression Compression = newGzipCompression(gzip.DefaultCompression)
+)
+
+type noCompression struct{}
+
+func (noCompression) Compress(data []byte) ([]byte, error)   { return data, nil }
+func (noCompression) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+// flateCompression reuse writers because a flate writer is large to create
+type flateCompression struct {
+	level   int
+	writers sync.Pool
+}
+
+func newFlateCompression(level int) *flateCompression {
+	return &flateCompression{level: level}
+}
+
+func (f *flateCompression) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := f.writers.Get().(*flate.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+		if w, err = flate.NewWriter(&buf, f.level); err != nil {
+			return nil, err
+		}
+	}
+	defer f.writers.Put(w)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *flateCompression) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+type gzipCompression struct {
+	level   int
+	writers sync.Pool
+}
+
+func newGzipCompression(level int) *gzipCompression {
+	return &gzipCompression{level: level}
+}
+
+func (g *gzipCompression) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := g.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+		if w, err = gzip.NewWriterLevel(&buf, g.level); err != nil {
+			return nil, err
+		}
+	}
+	defer g.writers.Put(w)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *gzipCompression) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// encodeValue encode and compress value to store in cache, only called WithCompression
+func (l *localCache) encodeValue(value interface{}) ([]byte, error) {
+	data, err := l.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return l.compression.Compress(data)
+}
+
+// decodeValue decompress and decode the value stored in cache, return value as is without compression
+func (l *localCache) decodeValue(value interface{}) (interface{}, error) {
+	if l.compression == nil {
+		return value, nil
+	}
+	data, err := l.compression.Decompress(value.([]byte))
+	if err != nil {
+		return nil, err
+	}
+	return l.codec.Unmarshal(data)
+}
@@ -0,0 +1,61 @@
+package localcache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	for i, compression := range []Compression{NoCompression, FlateCompression, GzipCompression} {
+		c := NewLocalCache(WithCompression(compression), WithCodec(JSONCodec))
+		c.Set("a", "value")
+		if v, has := c.Get("a"); !has || v != "value" {
+			t.Errorf("TestCompression1 %d get a = %v, %v", i, v, has)
+		}
+		obj, _ := c.(*localCache).dict.Get("a")
+		if _, ok := c.(*localCache).policy.unpack(obj).value.([]byte); !ok {
+			t.Errorf("TestCompression2 %d value not stored as bytes", i)
+		}
+		if v, has := c.GetAndDelete("a"); !has || v != "value" {
+			t.Errorf("TestCompression3 %d get and delete a = %v, %v", i, v, has)
+		}
+		c.Stop()
+	}
+}
+
+func TestCompressionWeight(t *testing.T) {
+	weigher := func(key string, value interface{}) int64 {
+		return int64(len(value.([]byte)))
+	}
+	c := NewLocalCache(WithCompression(GzipCompression), WithCodec(JSONCodec), WithWeigher(weigher), WithCapacity(1000))
+	defer c.Stop()
+	// the value is much larger than capacity before compressed
+	c.Set("a", strings.Repeat("a", 10000))
+	if v, has := c.Get("a"); !has || len(v.(string)) != 10000 {
+		t.Fatalf("TestCompressionWeight1 get a has=%v", has)
+	}
+	if w := c.Stats().Weight; w <= 0 || w >= 1000 {
+		t.Errorf("TestCompressionWeight2 weight %d", w)
+	}
+}
+
+func TestCompressionSaveLoad(t *testing.T) {
+	c := NewLocalCache(WithCompression(FlateCompression))
+	c.Set("a", "value")
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatalf("TestCompressionSaveLoad1 err=%v", err)
+	}
+	c.Stop()
+
+	// snapshot is readable without compression
+	c = NewLocalCache()
+	defer c.Stop()
+	if err := c.Load(&buf); err != nil {
+		t.Fatalf("TestCompressionSaveLoad2 err=%v", err)
+	}
+	if v, _ := c.Get("a"); v != "value" {
+		t.Errorf("TestCompressionSaveLoad3 a = %v", v)
+	}
+}
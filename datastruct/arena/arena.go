@@ -0,0 +1,243 @@
+package arena
+
+import (
+	"encoding/binary"
+)
+
+// headerSize is the size of entry header: hash(8) expireTime(8) version(8) keyLen(4) valueLen(4)
+const headerSize = 32
+
+// Arena keep entries in a ring buffer of bytes and index them by hash of key,
+// so there is no pointer for GC to scan except the buffer and the index.
+// An entry never wraps around the end of buffer, the oldest entries are overwritten when buffer is full.
+// Set or Del leave the old entry in buffer until it is overwritten.
+// Keys with the same hash replace each other, the replaced key is passed to onEvict.
+// Arena is not safe for concurrent use.
+type Arena struct {
+	buf   []byte
+	index map[uint64]uint32 // hash -> offset of the live entry
+
+	head    int    // offset of the oldest entry
+	tail    int    // offset to write the next entry
+	end     int    // end of entries after head when wrapped
+	wrapped bool   // tail is wrapped to the start of buffer, entries are [head, end) and [0, tail)
+	entries int    // count of entries in buffer, include dead ones
+	used    int    // bytes of entries in buffer, include dead ones
+	version uint64 // version of the last entry set, never reset
+
+	// onEvict is called when a live entry is overwritten, replaced by a key with the same hash or deleted because expired
+	onEvict func(key []byte, expireTime int64)
+}
+
+// New return an arena with a buffer of size bytes
+func New(size int, onEvict func(key []byte, expireTime int64)) *Arena {
+	return &Arena{
+		buf:     make([]byte, size),
+		index:   make(map[uint64]uint32),
+		onEvict: onEvict,
+	}
+}
+
+// Get return the value and expireTime of key, value is a slice of buffer which is valid until next write
+func (a *Arena) Get(hash uint64, key string) ([]byte, int64, bool) {
+	off, has := a.index[hash]
+	if !has {
+		return nil, 0, false
+	}
+	entryKey, value, expireTime := a.read(int(off))
+	if string(entryKey) != key {
+		return nil, 0, false
+	}
+	return value, expireTime, true
+}
+
+// Version return the version of key, every Set of a key get a new greater version
+func (a *Arena) Version(hash uint64, key string) (uint64, bool) {
+	off, has := a.index[hash]
+	if !has {
+		return 0, false
+	}
+	if entryKey, _, _ := a.read(int(off)); string(entryKey) != key {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(a.buf[off+16:]), true
+}
+
+// Touch set expireTime of key without changing its version, return if the key exists
+func (a *Arena) Touch(hash uint64, key string, expireTime int64) bool {
+	off, has := a.index[hash]
+	if !has {
+		return false
+	}
+	if entryKey, _, _ := a.read(int(off)); string(entryKey) != key {
+		return false
+	}
+	binary.LittleEndian.PutUint64(a.buf[off+8:], uint64(expireTime))
+	return true
+}
+
+// Set write key-value as the newest entry, return false if the entry is larger than buffer
+func (a *Arena) Set(hash uint64, key string, value []byte, expireTime int64) bool {
+	// the old entry is dead now, so it is not evicted while alloc
+	if off, has := a.index[hash]; has {
+		delete(a.index, hash)
+		if oldKey, _, oldExpireTime := a.read(int(off)); string(oldKey) != key {
+			// another key with the same hash is replaced
+			a.onEvict(oldKey, oldExpireTime)
+		}
+	}
+	size := headerSize + len(key) + len(value)
+	if size > len(a.buf) {
+		return false
+	}
+	off := a.alloc(size)
+	entry := a.buf[off : off+size]
+	binary.LittleEndian.PutUint64(entry[0:], hash)
+	binary.LittleEndian.PutUint64(entry[8:], uint64(expireTime))
+	a.version++
+	binary.LittleEndian.PutUint64(entry[16:], a.version)
+	binary.LittleEndian.PutUint32(entry[24:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(entry[28:], uint32(len(value)))
+	copy(entry[headerSize:], key)
+	copy(entry[headerSize+len(key):], value)
+	a.index[hash] = uint32(off)
+	return true
+}
+
+// Del delete key and return if the key exists
+func (a *Arena) Del(hash uint64, key string) bool {
+	off, has := a.index[hash]
+	if !has {
+		return false
+	}
+	if entryKey, _, _ := a.read(int(off)); string(entryKey) != key {
+		return false
+	}
+	delete(a.index, hash)
+	return true
+}
+
+// DelExpired check at most count random keys and del the expired ones, return count of checked and deleted keys
+func (a *Arena) DelExpired(now int64, count int) (checked, deleted int) {
+	// range of map start at a random position
+	for hash, off := range a.index {
+		if checked >= count {
+			break
+		}
+		checked++
+		key, _, expireTime := a.read(int(off))
+		if now > expireTime {
+			delete(a.index, hash)
+			a.onEvict(key, expireTime)
+			deleted++
+		}
+	}
+	return checked, deleted
+}
+
+// Range call f for live entries from the oldest to the newest, stop when f return false.
+// key and value are slices of buffer which are valid in f.
+func (a *Arena) Range(f func(key, value []byte, expireTime int64) bool) {
+	if a.entries == 0 {
+		return
+	}
+	if a.wrapped {
+		if !a.rangeSegment(a.head, a.end, f) {
+			return
+		}
+		a.rangeSegment(0, a.tail, f)
+		return
+	}
+	a.rangeSegment(a.head, a.tail, f)
+}
+
+// Len return count of live keys
+func (a *Arena) Len() int {
+	return len(a.index)
+}
+
+// Used return bytes of entries in buffer, include dead ones not overwritten yet
+func (a *Arena) Used() int {
+	return a.used
+}
+
+// Reset del all entries
+func (a *Arena) Reset() {
+	a.index = make(map[uint64]uint32)
+	a.head, a.tail, a.end = 0, 0, 0
+	a.wrapped = false
+	a.entries, a.used = 0, 0
+}
+
+func (a *Arena) rangeSegment(from, to int, f func(key, value []byte, expireTime int64) bool) bool {
+	for off := from; off < to; {
+		hash := binary.LittleEndian.Uint64(a.buf[off:])
+		key, value, expireTime := a.read(off)
+		if idx, has := a.index[hash]; has && int(idx) == off {
+			if !f(key, value, expireTime) {
+				return false
+			}
+		}
+		off += headerSize + len(key) + len(value)
+	}
+	return true
+}
+
+// read the entry at off
+func (a *Arena) read(off int) (key, value []byte, expireTime int64) {
+	expireTime = int64(binary.LittleEndian.Uint64(a.buf[off+8:]))
+	keyLen := int(binary.LittleEndian.Uint32(a.buf[off+24:]))
+	valueLen := int(binary.LittleEndian.Uint32(a.buf[off+28:]))
+	key = a.buf[off+headerSize : off+headerSize+keyLen]
+	value = a.buf[off+headerSize+keyLen : off+headerSize+keyLen+valueLen]
+	return key, value, expireTime
+}
+
+// alloc return offset of size bytes free space, overwrite the oldest entries if need
+func (a *Arena) alloc(size int) int {
+	for {
+		if a.entries == 0 {
+			a.head, a.tail, a.end = 0, 0, 0
+			a.wrapped = false
+		}
+		if !a.wrapped {
+			// free space is [tail, len) and [0, head)
+			if a.tail+size <= len(a.buf) {
+				break
+			}
+			a.end = a.tail
+			a.tail = 0
+			a.wrapped = true
+			continue
+		}
+		// free space is [tail, head)
+		if a.tail+size <= a.head {
+			break
+		}
+		a.pop()
+	}
+	off := a.tail
+	a.tail += size
+	a.entries++
+	a.used += size
+	return off
+}
+
+// pop overwrite the oldest entry
+func (a *Arena) pop() {
+	off := a.head
+	hash := binary.LittleEndian.Uint64(a.buf[off:])
+	key, value, expireTime := a.read(off)
+	if idx, has := a.index[hash]; has && int(idx) == off {
+		delete(a.index, hash)
+		a.onEvict(key, expireTime)
+	}
+	size := headerSize + len(key) + len(value)
+	a.head += size
+	a.entries--
+	a.used -= size
+	if a.head == a.end {
+		a.head = 0
+		a.wrapped = false
+	}
+}
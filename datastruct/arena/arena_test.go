@@ -0,0 +1,100 @@
+package arena
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	var evicted []string
+	a := New(120, func(key []byte, expireTime int64) {
+		evicted = append(evicted, string(key))
+	})
+	// every entry is 32+1+5 = 38 bytes, 3 entries fit
+	for i := 0; i < 3; i++ {
+		key := strconv.Itoa(i)
+		a.Set(uint64(i), key, []byte("value"), 10)
+	}
+	if a.Len() != 3 || a.Used() != 114 {
+		t.Fatalf("TestArena1 len %d used %d", a.Len(), a.Used())
+	}
+	if v, exp, has := a.Get(1, "1"); !has || string(v) != "value" || exp != 10 {
+		t.Errorf("TestArena2 get 1 = %s %d %v", v, exp, has)
+	}
+	if _, _, has := a.Get(1, "other"); has {
+		t.Error("TestArena3 get key with same hash")
+	}
+	// wrap and overwrite the oldest 0
+	a.Set(3, "3", []byte("value"), 10)
+	if len(evicted) != 1 || evicted[0] != "0" {
+		t.Errorf("TestArena4 evicted %v", evicted)
+	}
+	// deleted 1 is overwritten without evict
+	a.Del(1, "1")
+	a.Set(4, "4", []byte("value"), 10)
+	if len(evicted) != 1 || a.Len() != 3 {
+		t.Errorf("TestArena5 evicted %v len %d", evicted, a.Len())
+	}
+	var keys []string
+	a.Range(func(key, value []byte, expireTime int64) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	if len(keys) != 3 || keys[0] != "2" || keys[1] != "3" || keys[2] != "4" {
+		t.Errorf("TestArena6 range keys %v", keys)
+	}
+	if a.Set(5, "5", make([]byte, 120), 10) {
+		t.Error("TestArena7 set entry larger than buffer")
+	}
+	// every set get a new version
+	v1, _ := a.Version(4, "4")
+	a.Set(4, "4", []byte("value"), 10)
+	if v2, has := a.Version(4, "4"); !has || v2 <= v1 {
+		t.Errorf("TestArena8 version of 4 = %d, %v, old %d", v2, has, v1)
+	}
+	// touch change expireTime only
+	v1, _ = a.Version(4, "4")
+	if !a.Touch(4, "4", 20) || a.Touch(5, "5", 20) {
+		t.Error("TestArena9 touch")
+	}
+	if _, expireTime, _ := a.Get(4, "4"); expireTime != 20 {
+		t.Errorf("TestArena10 expireTime %d", expireTime)
+	}
+	if v2, _ := a.Version(4, "4"); v2 != v1 {
+		t.Errorf("TestArena11 version changed by touch %d, old %d", v2, v1)
+	}
+}
+
+func TestArenaDelExpired(t *testing.T) {
+	var evicted int
+	a := New(1000, func(key []byte, expireTime int64) { evicted++ })
+	a.Set(1, "1", nil, 5)
+	a.Set(2, "2", nil, 20)
+	checked, deleted := a.DelExpired(10, 10)
+	if checked != 2 || deleted != 1 || evicted != 1 || a.Len() != 1 {
+		t.Errorf("TestArenaDelExpired checked %d deleted %d evicted %d len %d", checked, deleted, evicted, a.Len())
+	}
+}
+
+func TestArenaCollision(t *testing.T) {
+	var evicted []string
+	a := New(1000, func(key []byte, expireTime int64) {
+		evicted = append(evicted, string(key))
+	})
+	a.Set(1, "a", []byte("1"), 10)
+	a.Set(1, "a", []byte("2"), 10)
+	if len(evicted) != 0 {
+		t.Errorf("TestArenaCollision1 set again evicted %v", evicted)
+	}
+	// b has the same hash as a and replaces it
+	a.Set(1, "b", []byte("3"), 10)
+	if len(evicted) != 1 || evicted[0] != "a" {
+		t.Errorf("TestArenaCollision2 evicted %v", evicted)
+	}
+	if _, _, has := a.Get(1, "a"); has {
+		t.Error("TestArenaCollision3 get replaced a")
+	}
+	if v, _, has := a.Get(1, "b"); !has || string(v) != "3" {
+		t.Errorf("TestArenaCollision4 get b = %s, %v", v, has)
+	}
+}
@@ -13,6 +13,9 @@ type Dict interface {
 	Del(key string) bool
 	// RandKeys get count rand keys, may return keys repeat!
 	RandKeys(count int) []string
+	// Range call f for every key-value, stop when f return false.
+	//  f is called under the shard read lock, so it must not call the dict.
+	Range(f func(key string, value interface{}) bool)
 	Len() int
 	Flush()
 }
@@ -83,6 +86,14 @@ func (m *concurrentMap) RandKeys(count int) []string {
 	return keys
 }
 
+func (m *concurrentMap) Range(f func(key string, value interface{}) bool) {
+	for _, shard := range m.shards {
+		if !shard.rangeFn(f) {
+			return
+		}
+	}
+}
+
 // getShard get shard by shardIdx
 func (m *concurrentMap) getShard(idx uint32) *shard {
 	return m.shards[idx]
@@ -126,6 +137,8 @@ func (m *shard) flush() {
 }
 
 func (m *shard) len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 	return len(m.store)
 }
 
@@ -138,3 +151,15 @@ func (m *shard) randKey() string {
 	// shard is empty
 	return ""
 }
+
+// rangeFn call f for every key-value in shard, return false if f stopped the range
+func (m *shard) rangeFn(f func(key string, value interface{}) bool) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for key, value := range m.store {
+		if !f(key, value) {
+			return false
+		}
+	}
+	return true
+}
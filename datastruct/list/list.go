@@ -63,6 +63,9 @@ func (l *List) NewElement(value interface{}) *Element {
 // The complexity is O(1).
 func (l *List) Len() int { return l.len }
 
+// Contains reports whether e is an element of list l.
+func (l *List) Contains(e *Element) bool { return e.list == l }
+
 // Front returns the first element of list l or nil if the list is empty.
 func (l *List) Front() *Element {
 	if l.len == 0 {
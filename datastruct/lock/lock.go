@@ -42,6 +42,28 @@ func (l *Locker) RUnlock(key string) {
 	lock.RUnlock()
 }
 
+// LockIndex lock the keys whose shard index is idx
+func (l *Locker) LockIndex(idx uint32) {
+	l.getLock(idx).Lock()
+}
+
+func (l *Locker) UnlockIndex(idx uint32) {
+	l.getLock(idx).Unlock()
+}
+
+// LockAll lock all keys, used to do something on the whole data
+func (l *Locker) LockAll() {
+	for _, lock := range l.locks {
+		lock.Lock()
+	}
+}
+
+func (l *Locker) UnlockAll() {
+	for _, lock := range l.locks {
+		lock.Unlock()
+	}
+}
+
 func (l *Locker) getLock(idx uint32) *sync.RWMutex {
 	return l.locks[idx]
 }
@@ -0,0 +1,405 @@
+package logstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// headerSize is the size of record header: keyLen(4) valueLen(4)
+	headerSize = 8
+
+	maxSegmentSize = 64 << 20
+	// segment files are named like logstore-00000001.seg, only these files in dir are removed
+	segmentPrefix = "logstore-"
+	segmentExt    = ".seg"
+)
+
+var (
+	// ErrTooLarge is returned by Set when a record is larger than capacity
+	ErrTooLarge = errors.New("logstore: record is larger than capacity")
+	// ErrClosed is returned by Set after Close
+	ErrClosed = errors.New("logstore: store is closed")
+)
+
+// Store keep entries in append-only segment files and index them in memory.
+// Set append a record to the active segment, the old record of key becomes garbage.
+// When files are larger than capacity the oldest segment is dropped,
+// Compact rewrite the live records of the segment with most garbage.
+// Segment files in dir are removed by Open and Close, the store is not durable. Other files in dir are kept.
+type Store struct {
+	lock        sync.Mutex
+	dir         string
+	capacity    int64
+	segmentSize int64
+	nextID      uint64
+	segments    []*segment // from the oldest to the active one
+	index       map[string]*location
+	size        int64 // bytes of segment files
+}
+
+type segment struct {
+	id   uint64
+	file *os.File
+	size int64
+	live int64 // bytes of live records
+}
+
+// location of the live record of a key
+type location struct {
+	seg        *segment
+	off        int64
+	size       int64
+	expireTime int64
+	tags       []string
+}
+
+// Open create a store in dir which keeps at most capacity bytes of files
+func Open(dir string, capacity int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:         dir,
+		capacity:    capacity,
+		segmentSize: capacity / 8,
+		index:       make(map[string]*location),
+	}
+	if s.segmentSize > maxSegmentSize {
+		s.segmentSize = maxSegmentSize
+	}
+	if err := s.removeFiles(); err != nil {
+		return nil, err
+	}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get return the value, tags and expireTime of key
+func (s *Store) Get(key string) (value []byte, tags []string, expireTime int64, ok bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	loc, has := s.index[key]
+	if !has {
+		return nil, nil, 0, false, nil
+	}
+	_, value, err = s.read(loc)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+	return value, loc.tags, loc.expireTime, true, nil
+}
+
+// Take get key and del it
+func (s *Store) Take(key string) (value []byte, tags []string, expireTime int64, ok bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	loc, has := s.index[key]
+	if !has {
+		return nil, nil, 0, false, nil
+	}
+	s.del(key, loc)
+	_, value, err = s.read(loc)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+	return value, loc.tags, loc.expireTime, true, nil
+}
+
+// ExpireTime return expireTime of key without read the file
+func (s *Store) ExpireTime(key string) (int64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	loc, has := s.index[key]
+	if !has {
+		return 0, false
+	}
+	return loc.expireTime, true
+}
+
+// Set append a record of key, drop the oldest segments if files are larger than capacity
+func (s *Store) Set(key string, value []byte, tags []string, expireTime int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if loc, has := s.index[key]; has {
+		s.del(key, loc)
+	}
+	record := encode(key, value)
+	if int64(len(record)) > s.capacity {
+		return ErrTooLarge
+	}
+	if err := s.append(key, record, tags, expireTime); err != nil {
+		return err
+	}
+	return s.fit()
+}
+
+// Del delete key and return if the key exists
+func (s *Store) Del(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	loc, has := s.index[key]
+	if has {
+		s.del(key, loc)
+	}
+	return has
+}
+
+// DelExpired check at most count random keys and del the expired ones, return count of deleted keys
+func (s *Store) DelExpired(now int64, count int) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var checked, deleted int
+	// range of map start at a random position
+	for key, loc := range s.index {
+		if checked >= count {
+			break
+		}
+		checked++
+		if now > loc.expireTime {
+			s.del(key, loc)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Range call f for every key, stop when f return false. f must not call the store.
+func (s *Store) Range(f func(key string, tags []string, expireTime int64) bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, loc := range s.index {
+		if !f(key, loc.tags, loc.expireTime) {
+			return
+		}
+	}
+}
+
+// Len return count of keys
+func (s *Store) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.index)
+}
+
+// Size return bytes of segment files
+func (s *Store) Size() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.size
+}
+
+// Compact rewrite live records not expired of the segment with most garbage to the active segment,
+// only segments with more than half garbage are compacted. Return if a segment is compacted.
+func (s *Store) Compact(now int64) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.segments) < 2 {
+		return false, nil
+	}
+	var victim *segment
+	// the active segment is not compacted
+	for _, seg := range s.segments[:len(s.segments)-1] {
+		if seg.live*2 < seg.size && (victim == nil || seg.live*victim.size < victim.live*seg.size) {
+			victim = seg
+		}
+	}
+	if victim == nil {
+		return false, nil
+	}
+	err := s.scan(victim, func(key string, loc *location, record []byte) error {
+		s.del(key, loc)
+		if now > loc.expireTime {
+			return nil
+		}
+		return s.append(key, record, loc.tags, loc.expireTime)
+	})
+	if err != nil {
+		return false, err
+	}
+	if err = s.remove(victim); err != nil {
+		return true, err
+	}
+	return true, s.fit()
+}
+
+// Reset del all keys and files
+func (s *Store) Reset() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for len(s.segments) > 0 {
+		if err := s.remove(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	s.index = make(map[string]*location)
+	return s.rotate()
+}
+
+// Close close and remove all files
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var err error
+	for len(s.segments) > 0 {
+		if errRemove := s.remove(s.segments[0]); err == nil {
+			err = errRemove
+		}
+	}
+	s.index = make(map[string]*location)
+	return err
+}
+
+// append write record to the active segment and index it
+func (s *Store) append(key string, record []byte, tags []string, expireTime int64) error {
+	if len(s.segments) == 0 {
+		return ErrClosed
+	}
+	active := s.segments[len(s.segments)-1]
+	if active.size > 0 && active.size+int64(len(record)) > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+	if _, err := active.file.WriteAt(record, active.size); err != nil {
+		return err
+	}
+	s.index[key] = &location{
+		seg:        active,
+		off:        active.size,
+		size:       int64(len(record)),
+		expireTime: expireTime,
+		tags:       tags,
+	}
+	active.size += int64(len(record))
+	active.live += int64(len(record))
+	s.size += int64(len(record))
+	return nil
+}
+
+// del key from index, its record becomes garbage
+func (s *Store) del(key string, loc *location) {
+	delete(s.index, key)
+	loc.seg.live -= loc.size
+}
+
+// fit drop the oldest segments until files are not larger than capacity
+func (s *Store) fit() error {
+	for s.size > s.capacity && len(s.segments) > 1 {
+		if err := s.dropOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropOldest del the keys of the oldest segment and remove it
+func (s *Store) dropOldest() error {
+	oldest := s.segments[0]
+	err := s.scan(oldest, func(key string, loc *location, _ []byte) error {
+		s.del(key, loc)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.remove(oldest)
+}
+
+// scan call f for live records of seg
+func (s *Store) scan(seg *segment, f func(key string, loc *location, record []byte) error) error {
+	data := make([]byte, seg.size)
+	if _, err := seg.file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return err
+	}
+	for off := int64(0); off < seg.size; {
+		key, _, size := decode(data[off:])
+		if loc, has := s.index[key]; has && loc.seg == seg && loc.off == off {
+			if err := f(key, loc, data[off:off+size]); err != nil {
+				return err
+			}
+		}
+		off += size
+	}
+	return nil
+}
+
+// read the record of loc
+func (s *Store) read(loc *location) (key string, value []byte, err error) {
+	record := make([]byte, loc.size)
+	if _, err = loc.seg.file.ReadAt(record, loc.off); err != nil && err != io.EOF {
+		return "", nil, err
+	}
+	key, value, _ = decode(record)
+	return key, value, nil
+}
+
+// rotate create a new active segment
+func (s *Store) rotate() error {
+	s.nextID++
+	f, err := os.OpenFile(s.segmentPath(s.nextID), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, &segment{id: s.nextID, file: f})
+	return nil
+}
+
+// remove close and remove the file of seg
+func (s *Store) remove(seg *segment) error {
+	for i, one := range s.segments {
+		if one == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	s.size -= seg.size
+	err := seg.file.Close()
+	if errRemove := os.Remove(seg.file.Name()); err == nil {
+		err = errRemove
+	}
+	return err
+}
+
+// removeFiles remove segment files left in dir by a store before
+func (s *Store) removeFiles() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, segmentPrefix+"[0-9]*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err = os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%08d%s", segmentPrefix, id, segmentExt))
+}
+
+// encode a record: header, key and value. expireTime and tags are kept in index only.
+func encode(key string, value []byte) []byte {
+	record := make([]byte, headerSize, headerSize+len(key)+len(value))
+	binary.LittleEndian.PutUint32(record[0:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[4:], uint32(len(value)))
+	record = append(record, key...)
+	return append(record, value...)
+}
+
+// decode return key, value and size of the record at the start of data
+func decode(data []byte) (key string, value []byte, size int64) {
+	keyLen := int64(binary.LittleEndian.Uint32(data[0:]))
+	valueLen := int64(binary.LittleEndian.Uint32(data[4:]))
+	key = string(data[headerSize : headerSize+keyLen])
+	return key, data[headerSize+keyLen : headerSize+keyLen+valueLen], headerSize + keyLen + valueLen
+}
@@ -0,0 +1,107 @@
+package logstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 1000)
+	if err != nil {
+		t.Fatalf("TestStore1 err=%v", err)
+	}
+	defer s.Close()
+	if err = s.Set("a", []byte("1"), []string{"tag"}, 10); err != nil {
+		t.Fatalf("TestStore2 err=%v", err)
+	}
+	value, tags, expireTime, ok, err := s.Get("a")
+	if !ok || err != nil || string(value) != "1" || len(tags) != 1 || expireTime != 10 {
+		t.Errorf("TestStore3 get a = %s %v %d %v %v", value, tags, expireTime, ok, err)
+	}
+	if value, _, _, ok, _ = s.Take("a"); !ok || string(value) != "1" || s.Len() != 0 {
+		t.Errorf("TestStore4 take a = %s %v len %d", value, ok, s.Len())
+	}
+	if err = s.Set("big", make([]byte, 1000), nil, 10); err != ErrTooLarge {
+		t.Errorf("TestStore5 set big err=%v", err)
+	}
+	s.Set("b", nil, nil, 5)
+	if n := s.DelExpired(6, 10); n != 1 {
+		t.Errorf("TestStore6 del expired %d <> 1", n)
+	}
+}
+
+func TestStoreCapacity(t *testing.T) {
+	s, _ := Open(t.TempDir(), 1000)
+	defer s.Close()
+	// every record is 8+3+97 = 108 bytes, segment is 125 bytes and keeps 1 record
+	for i := 100; i < 200; i++ {
+		s.Set(strconv.Itoa(i), make([]byte, 97), nil, 10)
+	}
+	if s.Size() > 1000 || s.Len() != 9 {
+		t.Errorf("TestStoreCapacity1 size %d len %d", s.Size(), s.Len())
+	}
+	if _, _, _, ok, _ := s.Get("199"); !ok {
+		t.Error("TestStoreCapacity2 newest key dropped")
+	}
+	if _, _, _, ok, _ := s.Get("100"); ok {
+		t.Error("TestStoreCapacity3 oldest key not dropped")
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir, 8000)
+	defer s.Close()
+	// segment is 1000 bytes and keeps 9 records
+	for i := 100; i < 118; i++ {
+		s.Set(strconv.Itoa(i), make([]byte, 97), nil, 10)
+	}
+	// first segment keeps 100-108, del most of them
+	for i := 100; i < 107; i++ {
+		s.Del(strconv.Itoa(i))
+	}
+	s.Set("expired", nil, nil, 1)
+	if compacted, err := s.Compact(5); !compacted || err != nil {
+		t.Fatalf("TestStoreCompact1 compacted %v err=%v", compacted, err)
+	}
+	if _, err := os.Stat(s.segmentPath(1)); !os.IsNotExist(err) {
+		t.Errorf("TestStoreCompact2 first segment not removed, err=%v", err)
+	}
+	if _, _, _, ok, _ := s.Get("108"); !ok || s.Len() != 12 {
+		t.Errorf("TestStoreCompact3 live key lost, len %d", s.Len())
+	}
+	if compacted, _ := s.Compact(5); compacted {
+		t.Error("TestStoreCompact4 compact segments without garbage")
+	}
+	if s.Size() > 8000 {
+		t.Errorf("TestStoreCompact5 size %d over capacity", s.Size())
+	}
+}
+
+func TestStoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	// files not created by a store are kept by Open and Close
+	other := filepath.Join(dir, "other"+segmentExt)
+	if err := ioutil.WriteFile(other, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	left := filepath.Join(dir, segmentPrefix+"00000009"+segmentExt)
+	if err := ioutil.WriteFile(left, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir, 1000)
+	if err != nil {
+		t.Fatalf("TestStoreFiles1 err=%v", err)
+	}
+	if _, err := os.Stat(left); !os.IsNotExist(err) {
+		t.Errorf("TestStoreFiles2 segment left by a store not removed, err=%v", err)
+	}
+	s.Close()
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("TestStoreFiles3 other file removed, err=%v", err)
+	}
+}
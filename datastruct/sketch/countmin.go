@@ -0,0 +1,85 @@
+// Package sketch is probabilistic structures to estimate frequency of keys,
+// a count-min sketch and a top-k heavy hitters tracker built on it.
+package sketch
+
+import "github.com/MoeYang/go-localcache/common"
+
+const (
+	cmDepth       = 4  // count of rows
+	cmResetFactor = 10 // halve all counters after width*cmResetFactor increments
+)
+
+// CountMin is a count-min sketch with conservative update.
+// Counters are halved periodically, so the estimate favors recent keys, like TinyLFU.
+// CountMin is not concurrent safe.
+type CountMin struct {
+	rows    [cmDepth][]uint32
+	mask    uint64
+	added   uint64 // increments since last reset
+	resetAt uint64
+}
+
+// NewCountMin return a sketch with width counters per row, width is rounded up to a power of 2
+func NewCountMin(width int) *CountMin {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	c := &CountMin{mask: uint64(w - 1), resetAt: uint64(w) * cmResetFactor}
+	for i := range c.rows {
+		c.rows[i] = make([]uint32, w)
+	}
+	return c
+}
+
+// Incr add 1 to key and return the estimate count after increment
+func (c *CountMin) Incr(key string) uint32 {
+	var idx [cmDepth]uint64
+	h := common.Hash64(key)
+	// double hashing to get index of every row
+	h1, h2 := h&0xffffffff, h>>32
+	min := ^uint32(0)
+	for i := range c.rows {
+		idx[i] = (h1 + uint64(i)*h2) & c.mask
+		if v := c.rows[i][idx[i]]; v < min {
+			min = v
+		}
+	}
+	// conservative update: only add the counters equal to the min
+	if min != ^uint32(0) {
+		min++
+		for i := range c.rows {
+			if c.rows[i][idx[i]] < min {
+				c.rows[i][idx[i]] = min
+			}
+		}
+	}
+	c.added++
+	if c.added >= c.resetAt {
+		c.reset()
+	}
+	return min
+}
+
+// Estimate return the estimate count of key
+func (c *CountMin) Estimate(key string) uint32 {
+	h := common.Hash64(key)
+	h1, h2 := h&0xffffffff, h>>32
+	min := ^uint32(0)
+	for i := range c.rows {
+		if v := c.rows[i][(h1+uint64(i)*h2)&c.mask]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// reset halve all counters
+func (c *CountMin) reset() {
+	for i := range c.rows {
+		for j := range c.rows[i] {
+			c.rows[i][j] >>= 1
+		}
+	}
+	c.added /= 2
+}
@@ -0,0 +1,131 @@
+package sketch
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// Item is a key and its estimate count
+type Item struct {
+	Key   string
+	Count uint32
+}
+
+// TopK track the k most frequent keys, frequency is estimated by a CountMin.
+// TopK is concurrent safe.
+type TopK struct {
+	lock   sync.Mutex
+	k      int
+	sketch *CountMin
+	heap   itemHeap       // min heap of the top k keys
+	index  map[string]int // key -> position in heap
+}
+
+// NewTopK return a TopK tracking k keys
+func NewTopK(k int) *TopK {
+	if k < 1 {
+		k = 1
+	}
+	t := &TopK{
+		k:      k,
+		sketch: NewCountMin(k * 256),
+		index:  make(map[string]int, k),
+	}
+	t.heap.index = t.index
+	return t
+}
+
+// Add record a visit of key
+func (t *TopK) Add(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	added := t.sketch.added
+	count := t.sketch.Incr(key)
+	if t.sketch.added < added {
+		// sketch is reset, halve counts in heap too
+		for i := range t.heap.items {
+			t.heap.items[i].Count >>= 1
+		}
+		heap.Init(&t.heap)
+		count = t.sketch.Estimate(key)
+	}
+	if i, has := t.index[key]; has {
+		t.heap.items[i].Count = count
+		heap.Fix(&t.heap, i)
+		return
+	}
+	if len(t.heap.items) < t.k {
+		heap.Push(&t.heap, Item{Key: key, Count: count})
+		return
+	}
+	// replace the min one
+	if count > t.heap.items[0].Count {
+		delete(t.index, t.heap.items[0].Key)
+		t.heap.items[0] = Item{Key: key, Count: count}
+		t.index[key] = 0
+		heap.Fix(&t.heap, 0)
+	}
+}
+
+// List return at most n keys sorted by count desc
+func (t *TopK) List(n int) []Item {
+	t.lock.Lock()
+	items := make([]Item, len(t.heap.items))
+	copy(items, t.heap.items)
+	t.lock.Unlock()
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Count > items[j].Count
+	})
+	if n >= 0 && n < len(items) {
+		items = items[:n]
+	}
+	return items
+}
+
+// Remove a key from top k, like when the key is deleted
+func (t *TopK) Remove(key string) {
+	t.lock.Lock()
+	if i, has := t.index[key]; has {
+		heap.Remove(&t.heap, i)
+	}
+	t.lock.Unlock()
+}
+
+// Reset clear all keys and counts
+func (t *TopK) Reset() {
+	t.lock.Lock()
+	t.sketch = NewCountMin(t.k * 256)
+	t.heap.items = t.heap.items[:0]
+	for key := range t.index {
+		delete(t.index, key)
+	}
+	t.lock.Unlock()
+}
+
+// itemHeap implement heap.Interface, keep index of keys when swap
+type itemHeap struct {
+	items []Item
+	index map[string]int
+}
+
+func (h *itemHeap) Len() int           { return len(h.items) }
+func (h *itemHeap) Less(i, j int) bool { return h.items[i].Count < h.items[j].Count }
+func (h *itemHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].Key] = i
+	h.index[h.items[j].Key] = j
+}
+
+func (h *itemHeap) Push(x interface{}) {
+	item := x.(Item)
+	h.index[item.Key] = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *itemHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	delete(h.index, item.Key)
+	return item
+}
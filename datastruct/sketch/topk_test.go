@@ -0,0 +1,51 @@
+package sketch
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	topk := NewTopK(3)
+	for i := 0; i < 1000; i++ {
+		topk.Add("hot1")
+		if i%2 == 0 {
+			topk.Add("hot2")
+		}
+		if i%4 == 0 {
+			topk.Add("hot3")
+		}
+		// cold keys visit once
+		topk.Add("cold" + strconv.Itoa(i))
+	}
+	items := topk.List(10)
+	if len(items) != 3 {
+		t.Fatalf("TestTopK1 items %+v", items)
+	}
+	for i, key := range []string{"hot1", "hot2", "hot3"} {
+		if items[i].Key != key {
+			t.Errorf("TestTopK2 items %+v", items)
+		}
+	}
+	if items[0].Count < 900 {
+		t.Errorf("TestTopK3 hot1 count %d", items[0].Count)
+	}
+	topk.Remove("hot1")
+	if items = topk.List(1); items[0].Key != "hot2" {
+		t.Errorf("TestTopK4 items %+v", items)
+	}
+}
+
+func TestCountMinReset(t *testing.T) {
+	c := NewCountMin(16)
+	for i := 0; i < 100; i++ {
+		c.Incr("k")
+	}
+	// 16*10 increments will halve all counters
+	for i := 0; i < 60; i++ {
+		c.Incr(strconv.Itoa(i))
+	}
+	if n := c.Estimate("k"); n >= 100 {
+		t.Errorf("TestCountMinReset estimate %d", n)
+	}
+}
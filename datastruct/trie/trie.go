@@ -0,0 +1,252 @@
+// Package trie is a concurrent safe radix tree of string keys,
+// used as an index to find keys by prefix or glob pattern without scan the dict.
+package trie
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/MoeYang/go-localcache/common"
+)
+
+// shardCount is the count of trees keys are spread to, must be a power of 2
+const shardCount = 32
+
+// Trie spread keys to shards by hash, every shard is a radix tree with its own lock,
+// so Insert and Delete of different keys seldom wait on each other.
+// A query walks all shards one by one.
+type Trie struct {
+	shards [shardCount]*tree
+}
+
+// tree is a radix tree, every node keeps a label of bytes and nodes with one child are merged
+type tree struct {
+	lock sync.RWMutex
+	root *node
+	len  int
+}
+
+type node struct {
+	label    string  // bytes from parent to this node
+	children []*node // sorted by the first byte of label
+	end      bool    // a key ends at this node
+}
+
+// New return an empty trie
+func New() *Trie {
+	t := &Trie{}
+	for i := range t.shards {
+		t.shards[i] = &tree{root: &node{}}
+	}
+	return t
+}
+
+// Insert add key to trie, return false if key exists already
+func (t *Trie) Insert(key string) bool {
+	s := t.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.root.insert(key) {
+		return false
+	}
+	s.len++
+	return true
+}
+
+// Delete remove key from trie and prune empty nodes, return false if key not exists
+func (t *Trie) Delete(key string) bool {
+	s := t.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.root.delete(key) {
+		return false
+	}
+	s.len--
+	return true
+}
+
+// WalkPrefix call f for keys start with prefix in no order, stop when f return false.
+// A shard is read locked while f is called, so f must not change the trie.
+func (t *Trie) WalkPrefix(prefix string, f func(key string) bool) {
+	for _, s := range t.shards {
+		s.lock.RLock()
+		goon := s.root.walkPrefix(prefix, f)
+		s.lock.RUnlock()
+		if !goon {
+			return
+		}
+	}
+}
+
+// PrefixKeys return all keys start with prefix
+func (t *Trie) PrefixKeys(prefix string) []string {
+	var keys []string
+	t.WalkPrefix(prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Match return all keys match the glob pattern, only keys start with the literal prefix of pattern are checked
+func (t *Trie) Match(pattern string) []string {
+	var keys []string
+	t.WalkPrefix(common.GlobPrefix(pattern), func(key string) bool {
+		if common.MatchGlob(pattern, key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// Len return count of keys in trie
+func (t *Trie) Len() int {
+	var n int
+	for _, s := range t.shards {
+		s.lock.RLock()
+		n += s.len
+		s.lock.RUnlock()
+	}
+	return n
+}
+
+// Flush remove all keys
+func (t *Trie) Flush() {
+	for _, s := range t.shards {
+		s.lock.Lock()
+		s.root = &node{}
+		s.len = 0
+		s.lock.Unlock()
+	}
+}
+
+func (t *Trie) shard(key string) *tree {
+	return t.shards[common.GetShardIndex(key, shardCount)]
+}
+
+// child return the index of child whose label start with c, and the child or nil if not exists
+func (n *node) child(c byte) (int, *node) {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label[0] >= c })
+	if i < len(n.children) && n.children[i].label[0] == c {
+		return i, n.children[i]
+	}
+	return i, nil
+}
+
+// insert key under n, return false if key exists already
+func (n *node) insert(key string) bool {
+	for len(key) > 0 {
+		i, child := n.child(key[0])
+		if child == nil {
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = &node{label: key, end: true}
+			return true
+		}
+		same := commonPrefixLen(child.label, key)
+		if same < len(child.label) {
+			// split the label of child at the first different byte
+			mid := &node{label: child.label[:same], children: []*node{child}}
+			child.label = child.label[same:]
+			n.children[i] = mid
+			child = mid
+		}
+		n = child
+		key = key[same:]
+	}
+	if n.end {
+		return false
+	}
+	n.end = true
+	return true
+}
+
+// delete key under n, the node of key is removed if it has no child or merged with its only child,
+// return false if key not exists
+func (n *node) delete(key string) bool {
+	var parent *node
+	for len(key) > 0 {
+		_, child := n.child(key[0])
+		if child == nil || !strings.HasPrefix(key, child.label) {
+			return false
+		}
+		parent, n = n, child
+		key = key[len(child.label):]
+	}
+	if !n.end {
+		return false
+	}
+	n.end = false
+	if parent == nil {
+		// the empty key ends at root, root is never removed
+		return true
+	}
+	switch len(n.children) {
+	case 0:
+		i, _ := parent.child(n.label[0])
+		parent.children = append(parent.children[:i], parent.children[i+1:]...)
+		if len(parent.children) == 0 {
+			parent.children = nil
+		}
+		// parent may be left as a node with one child and no key
+		if parent.label != "" && !parent.end && len(parent.children) == 1 {
+			parent.merge()
+		}
+	case 1:
+		n.merge()
+	}
+	return true
+}
+
+// merge the only child of n into n
+func (n *node) merge() {
+	child := n.children[0]
+	n.label += child.label
+	n.end = child.end
+	n.children = child.children
+}
+
+// walkPrefix call f for keys start with prefix under n, return false if f return false
+func (n *node) walkPrefix(prefix string, f func(key string) bool) bool {
+	path := make([]byte, 0, len(prefix)+16)
+	for len(prefix) > 0 {
+		_, child := n.child(prefix[0])
+		if child == nil {
+			return true
+		}
+		if strings.HasPrefix(prefix, child.label) {
+			prefix = prefix[len(child.label):]
+		} else if strings.HasPrefix(child.label, prefix) {
+			// prefix ends inside the label of child
+			prefix = ""
+		} else {
+			return true
+		}
+		path = append(path, child.label...)
+		n = child
+	}
+	return n.walk(path, f)
+}
+
+// walk call f for keys under n, path is the key of n
+func (n *node) walk(path []byte, f func(key string) bool) bool {
+	if n.end && !f(string(path)) {
+		return false
+	}
+	for _, child := range n.children {
+		if !child.walk(append(path, child.label...), f) {
+			return false
+		}
+	}
+	return true
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,169 @@
+package trie
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func sorted(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTrie(t *testing.T) {
+	tr := New()
+	for _, key := range []string{"user:1", "user:10", "user:2", "order:1", "u", ""} {
+		if !tr.Insert(key) {
+			t.Errorf("TestTrie1 insert %q false", key)
+		}
+	}
+	if tr.Insert("user:1") || tr.Len() != 6 {
+		t.Errorf("TestTrie2 insert exists key, len %d", tr.Len())
+	}
+	if keys := sorted(tr.PrefixKeys("user:1")); !equal(keys, []string{"user:1", "user:10"}) {
+		t.Errorf("TestTrie3 prefix keys %v", keys)
+	}
+	// prefix ends inside a label
+	if keys := sorted(tr.PrefixKeys("us")); !equal(keys, []string{"user:1", "user:10", "user:2"}) {
+		t.Errorf("TestTrie4 prefix keys %v", keys)
+	}
+	if keys := tr.PrefixKeys("x"); len(keys) != 0 {
+		t.Errorf("TestTrie5 prefix keys %v", keys)
+	}
+	if keys := tr.PrefixKeys(""); len(keys) != 6 {
+		t.Errorf("TestTrie6 all keys %v", keys)
+	}
+	if tr.Delete("user:3") || tr.Delete("user") || !tr.Delete("user:1") || tr.Delete("user:1") {
+		t.Error("TestTrie7 delete")
+	}
+	if keys := sorted(tr.PrefixKeys("user:")); !equal(keys, []string{"user:10", "user:2"}) {
+		t.Errorf("TestTrie8 prefix keys after delete %v", keys)
+	}
+	if !tr.Delete("") || tr.Len() != 4 {
+		t.Errorf("TestTrie9 delete empty key, len %d", tr.Len())
+	}
+	tr.Flush()
+	if tr.Len() != 0 || len(tr.PrefixKeys("")) != 0 {
+		t.Errorf("TestTrie10 flush len %d", tr.Len())
+	}
+}
+
+func TestTrieWalkPrefix(t *testing.T) {
+	tr := New()
+	for i := 0; i < 100; i++ {
+		tr.Insert("k" + strconv.Itoa(i))
+	}
+	var n int
+	tr.WalkPrefix("k", func(key string) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Errorf("TestTrieWalkPrefix1 walked %d keys after stop", n)
+	}
+	n = 0
+	tr.WalkPrefix("k1", func(key string) bool {
+		n++
+		return true
+	})
+	// k1 and k10-k19
+	if n != 11 {
+		t.Errorf("TestTrieWalkPrefix2 walked %d keys", n)
+	}
+}
+
+func TestTrieMatch(t *testing.T) {
+	tr := New()
+	for _, key := range []string{"user:1:name", "user:2:name", "user:2:age", "user:", "order:1:name"} {
+		tr.Insert(key)
+	}
+	cases := []struct {
+		pattern string
+		want    []string
+	}{
+		{"user:*:name", []string{"user:1:name", "user:2:name"}},
+		{"*:name", []string{"order:1:name", "user:1:name", "user:2:name"}},
+		{"user:?:a*", []string{"user:2:age"}},
+		{"user:", []string{"user:"}},
+		{"user:[13]*", []string{"user:1:name"}},
+		{"x*", nil},
+	}
+	for i, cs := range cases {
+		if keys := sorted(tr.Match(cs.pattern)); !equal(keys, cs.want) {
+			t.Errorf("TestTrieMatch%d %q = %v, want %v", i, cs.pattern, keys, cs.want)
+		}
+	}
+}
+
+func TestTriePrune(t *testing.T) {
+	// check nodes of a single tree
+	root := &node{}
+	for _, key := range []string{"abc", "abd", "ab", "b"} {
+		root.insert(key)
+	}
+	// root -> "ab"(end) -> "c", "d"; root -> "b"
+	if len(root.children) != 2 || root.children[0].label != "ab" || len(root.children[0].children) != 2 {
+		t.Fatalf("TestTriePrune1 labels not compressed")
+	}
+	root.delete("abc")
+	// "ab" keeps a key and a child, nothing is merged
+	ab := root.children[0]
+	if len(ab.children) != 1 || ab.children[0].label != "d" {
+		t.Errorf("TestTriePrune2 leaf not removed")
+	}
+	root.delete("ab")
+	// "ab" without key is merged with its only child "d"
+	if ab.label != "abd" || !ab.end || len(ab.children) != 0 {
+		t.Errorf("TestTriePrune3 node not merged, label %q", ab.label)
+	}
+	root.insert("abx")
+	root.insert("aby")
+	root.delete("abd")
+	root.delete("abx")
+	// split node "ab" is left with one child after delete, it is merged
+	if n := root.children[0]; n.label != "aby" || !n.end || len(n.children) != 0 {
+		t.Errorf("TestTriePrune4 parent not merged, label %q", n.label)
+	}
+	root.delete("aby")
+	root.delete("b")
+	if len(root.children) != 0 {
+		t.Errorf("TestTriePrune5 %d nodes left", len(root.children))
+	}
+}
+
+func TestTrieConcurrent(t *testing.T) {
+	tr := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa(i) + ":" + strconv.Itoa(j)
+				tr.Insert(key)
+				tr.PrefixKeys(strconv.Itoa(i))
+				if j%2 == 0 {
+					tr.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if tr.Len() != 4000 || len(tr.PrefixKeys("")) != 4000 {
+		t.Errorf("TestTrieConcurrent1 len %d", tr.Len())
+	}
+}
@@ -0,0 +1,183 @@
+// Package debughttp serve a running cache over http for debugging, and publish its stats by expvar.
+//
+//	mux.Handle("/debug/localcache/", http.StripPrefix("/debug/localcache", debughttp.NewHandler(cache)))
+//
+// Routes:
+//
+//	GET  /stats                                        stats of cache
+//	GET  /keys?prefix=&match=&cursor=&limit=           keys sorted, paged by cursor which is the last key of previous page
+//	GET  /key?key=                                     value and ttl of key
+//	GET  /ttl?key=                                     ttl of key
+//	POST /delete?key=                                  delete key, need WithWriteActions(true)
+//	POST /flush                                        flush cache, need WithWriteActions(true)
+package debughttp
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MoeYang/go-localcache"
+	"github.com/MoeYang/go-localcache/common"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 10000
+)
+
+type handler struct {
+	cache        localcache.Cache
+	writeActions bool // allow delete and flush
+	mux          *http.ServeMux
+}
+
+type Option func(*handler)
+
+// WithWriteActions set whether allow to delete keys and flush cache by http, default false
+func WithWriteActions(enable bool) Option {
+	return func(h *handler) {
+		h.writeActions = enable
+	}
+}
+
+// NewHandler return a http.Handler to inspect cache
+func NewHandler(cache localcache.Cache, options ...Option) http.Handler {
+	h := &handler{cache: cache, mux: http.NewServeMux()}
+	for _, opt := range options {
+		opt(h)
+	}
+	h.mux.HandleFunc("/stats", h.stats)
+	h.mux.HandleFunc("/keys", h.keys)
+	h.mux.HandleFunc("/key", h.key)
+	h.mux.HandleFunc("/ttl", h.ttl)
+	h.mux.HandleFunc("/delete", h.write(h.del))
+	h.mux.HandleFunc("/flush", h.write(h.flush))
+	return h
+}
+
+// Publish publish stats of cache by expvar with name, like expvar.Publish it panics if name is used
+func Publish(name string, cache localcache.Cache) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return cache.Stats()
+	}))
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.cache.Stats())
+}
+
+type keysResp struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next,omitempty"` // cursor of next page, empty if no more
+}
+
+func (h *handler) keys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix, match, cursor := query.Get("prefix"), query.Get("match"), query.Get("cursor")
+	limit := defaultPageLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	var keys []string
+	for _, key := range h.cache.Keys() {
+		if key <= cursor && cursor != "" {
+			continue
+		}
+		if strings.HasPrefix(key, prefix) && (match == "" || common.MatchGlob(match, key)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	resp := keysResp{Keys: keys}
+	if len(keys) > limit {
+		resp.Keys = keys[:limit]
+		resp.Next = keys[limit-1]
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type keyResp struct {
+	Key        string      `json:"key"`
+	Found      bool        `json:"found"`
+	Value      interface{} `json:"value,omitempty"`
+	TTLSeconds float64     `json:"ttl_seconds,omitempty"`
+}
+
+func (h *handler) key(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	// value is read by Peek, so inspecting a key changes no stats or order of eviction
+	ttl, found := h.cache.TTL(key)
+	resp := keyResp{Key: key, Found: found}
+	if found {
+		value, _ := h.cache.Peek(key)
+		resp.Value = jsonValue(value)
+		resp.TTLSeconds = ttl.Seconds()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) ttl(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	ttl, found := h.cache.TTL(key)
+	writeJSON(w, http.StatusOK, keyResp{Key: key, Found: found, TTLSeconds: ttl.Seconds()})
+}
+
+func (h *handler) del(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"key": key, "deleted": h.cache.Del(key)})
+}
+
+func (h *handler) flush(w http.ResponseWriter, r *http.Request) {
+	h.cache.Flush()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"flushed": true})
+}
+
+// write guard the write actions, only POST is allowed and need WithWriteActions(true)
+func (h *handler) write(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.writeActions {
+			writeError(w, http.StatusForbidden, "write actions are disabled")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "need POST")
+			return
+		}
+		f(w, r)
+	}
+}
+
+// jsonValue return value if it can be encoded to json, else its string format
+func jsonValue(value interface{}) interface{} {
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+	return value
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,92 @@
+package debughttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MoeYang/go-localcache"
+)
+
+func doJSON(t *testing.T, h http.Handler, method, url string, v interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+	if v != nil {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s err=%v", url, err)
+		}
+	}
+	return w.Code
+}
+
+func TestHandler(t *testing.T) {
+	c := localcache.NewLocalCache(localcache.WithStatist(true))
+	defer c.Stop()
+	for i := 0; i < 5; i++ {
+		c.Set("k"+strconv.Itoa(i), i)
+	}
+	h := NewHandler(c)
+
+	var stats localcache.Stats
+	if code := doJSON(t, h, "GET", "/stats", &stats); code != 200 || stats.Sets != 5 {
+		t.Errorf("TestHandler1 code %d stats %+v", code, stats)
+	}
+	var keys keysResp
+	doJSON(t, h, "GET", "/keys?limit=2", &keys)
+	if len(keys.Keys) != 2 || keys.Keys[0] != "k0" || keys.Next != "k1" {
+		t.Errorf("TestHandler2 keys %+v", keys)
+	}
+	doJSON(t, h, "GET", "/keys?limit=2&cursor="+keys.Next, &keys)
+	if len(keys.Keys) != 2 || keys.Keys[0] != "k2" {
+		t.Errorf("TestHandler3 keys %+v", keys)
+	}
+	var key keyResp
+	doJSON(t, h, "GET", "/key?key=k1", &key)
+	if !key.Found || key.Value.(float64) != 1 || key.TTLSeconds <= 0 {
+		t.Errorf("TestHandler4 key %+v", key)
+	}
+	if stats := c.Stats(); stats.Hits != 0 {
+		t.Errorf("TestHandler4 key counted as a hit, hits %d", stats.Hits)
+	}
+	doJSON(t, h, "GET", "/ttl?key=none", &key)
+	if key.Found {
+		t.Errorf("TestHandler5 key %+v", key)
+	}
+	if code := doJSON(t, h, "POST", "/delete?key=k1", nil); code != http.StatusForbidden {
+		t.Errorf("TestHandler6 code %d", code)
+	}
+
+	h = NewHandler(c, WithWriteActions(true))
+	if code := doJSON(t, h, "GET", "/delete?key=k1", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("TestHandler7 code %d", code)
+	}
+	var deleted map[string]interface{}
+	doJSON(t, h, "POST", "/delete?key=k1", &deleted)
+	if deleted["deleted"] != true {
+		t.Errorf("TestHandler8 %+v", deleted)
+	}
+	doJSON(t, h, "POST", "/flush", nil)
+	if c.Len() != 0 {
+		t.Errorf("TestHandler9 len %d", c.Len())
+	}
+}
+
+func TestPublish(t *testing.T) {
+	c := localcache.NewLocalCache()
+	defer c.Stop()
+	// expvar can not publish a name twice, so use a new name when test run many times
+	name := "localcache_test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	Publish(name, c)
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(w.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	if _, has := vars[name]; !has {
+		t.Errorf("TestPublish %s not published", name)
+	}
+}
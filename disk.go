@@ -0,0 +1,329 @@
+package localcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/MoeYang/go-localcache/datastruct/logstore"
+)
+
+const (
+	defaultDiskCompactTick = time.Second // compact a segment of disk tier every second
+)
+
+// diskTier is a logstore whose writes are done by diskProcess, so an eviction never waits disk io under locks.
+// A key set is pending in memory until written, reads see pending keys as in disk tier.
+type diskTier struct {
+	store   *logstore.Store
+	lock    sync.Mutex
+	pending map[string]*diskEntry
+	signal  chan struct{} // tell diskProcess there are pending keys to write
+}
+
+// diskEntry is a key waiting to be written
+type diskEntry struct {
+	data       []byte
+	tags       []string
+	expireTime int64
+}
+
+func newDiskTier(store *logstore.Store) *diskTier {
+	return &diskTier{
+		store:   store,
+		pending: make(map[string]*diskEntry),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+// Set add key to pending and signal diskProcess, never block
+func (d *diskTier) Set(key string, data []byte, tags []string, expireTime int64) {
+	d.lock.Lock()
+	d.pending[key] = &diskEntry{data: data, tags: tags, expireTime: expireTime}
+	d.lock.Unlock()
+	select {
+	case d.signal <- struct{}{}:
+	default:
+	}
+}
+
+// writePending write pending keys to store, called by diskProcess.
+// A key deleted or taken while written is deleted from store again, a key set again is written by the next call.
+func (d *diskTier) writePending(onError func(err error)) {
+	d.lock.Lock()
+	entries := make(map[string]*diskEntry, len(d.pending))
+	for key, entry := range d.pending {
+		entries[key] = entry
+	}
+	d.lock.Unlock()
+	for key, entry := range entries {
+		err := d.store.Set(key, entry.data, entry.tags, entry.expireTime)
+		// a value larger than disk tier is just dropped
+		if err != nil && err != logstore.ErrTooLarge {
+			onError(err)
+		}
+		d.lock.Lock()
+		if now, has := d.pending[key]; !has {
+			d.store.Del(key)
+		} else if now == entry {
+			delete(d.pending, key)
+		}
+		d.lock.Unlock()
+	}
+}
+
+// Take get key and del it
+func (d *diskTier) Take(key string) ([]byte, []string, int64, bool, error) {
+	d.lock.Lock()
+	entry, has := d.pending[key]
+	delete(d.pending, key)
+	d.lock.Unlock()
+	if has {
+		return entry.data, entry.tags, entry.expireTime, true, nil
+	}
+	return d.store.Take(key)
+}
+
+// Get return key without del it
+func (d *diskTier) Get(key string) ([]byte, int64, bool, error) {
+	d.lock.Lock()
+	entry, has := d.pending[key]
+	d.lock.Unlock()
+	if has {
+		return entry.data, entry.expireTime, true, nil
+	}
+	data, _, expireTime, has, err := d.store.Get(key)
+	return data, expireTime, has, err
+}
+
+// Del delete key
+func (d *diskTier) Del(key string) {
+	d.lock.Lock()
+	delete(d.pending, key)
+	d.lock.Unlock()
+	d.store.Del(key)
+}
+
+// ExpireTime return expireTime of key
+func (d *diskTier) ExpireTime(key string) (int64, bool) {
+	d.lock.Lock()
+	entry, has := d.pending[key]
+	d.lock.Unlock()
+	if has {
+		return entry.expireTime, true
+	}
+	return d.store.ExpireTime(key)
+}
+
+// Range call f for every key, stop when f return false. f must not call the disk tier.
+func (d *diskTier) Range(f func(key string, tags []string, expireTime int64) bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for key, entry := range d.pending {
+		if !f(key, entry.tags, entry.expireTime) {
+			return
+		}
+	}
+	d.store.Range(func(key string, tags []string, expireTime int64) bool {
+		if _, has := d.pending[key]; has {
+			// being written
+			return true
+		}
+		return f(key, tags, expireTime)
+	})
+}
+
+// Len return count of keys
+func (d *diskTier) Len() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	n := d.store.Len()
+	for key := range d.pending {
+		if _, has := d.store.ExpireTime(key); !has {
+			n++
+		}
+	}
+	return n
+}
+
+// Size return bytes of segment files
+func (d *diskTier) Size() int64 {
+	return d.store.Size()
+}
+
+// DelExpired check at most count random keys in store and del the expired ones, return count of deleted keys
+func (d *diskTier) DelExpired(now int64, count int) int {
+	return d.store.DelExpired(now, count)
+}
+
+// Compact a segment of store
+func (d *diskTier) Compact(now int64) (bool, error) {
+	return d.store.Compact(now)
+}
+
+// Reset del all keys and files
+func (d *diskTier) Reset() error {
+	d.lock.Lock()
+	d.pending = make(map[string]*diskEntry)
+	d.lock.Unlock()
+	return d.store.Reset()
+}
+
+// Close drop pending keys, close and remove all files
+func (d *diskTier) Close() error {
+	d.lock.Lock()
+	d.pending = make(map[string]*diskEntry)
+	d.lock.Unlock()
+	return d.store.Close()
+}
+
+// spill add the obj evicted from memory to disk tier, must be called with keyLock of key before remove.
+// The value is encoded here, the write is done by diskProcess without locks.
+func (l *localCache) spill(key string, obj interface{}) {
+	if l.disk == nil {
+		return
+	}
+	element := l.policy.unpack(obj)
+	element.lock.RLock()
+	value, expireTime, tags := element.value, element.expireTime, element.tags
+	element.lock.RUnlock()
+	if time.Now().Unix() > expireTime {
+		return
+	}
+	data, err := l.diskValue(value)
+	if err != nil {
+		l.onError(err)
+		return
+	}
+	l.disk.Set(key, data, tags, expireTime)
+}
+
+// promote move key from disk tier to memory, return the value decoded
+func (l *localCache) promote(key string) (interface{}, bool) {
+	l.keyLock.Lock(key)
+	if _, has := l.dict.Get(key); has {
+		// set by others after Get miss, the key is not in disk any more
+		l.keyLock.Unlock(key)
+		return nil, false
+	}
+	data, tags, expireTime, has, err := l.disk.Take(key)
+	if err != nil {
+		l.keyLock.Unlock(key)
+		l.onError(err)
+		return nil, false
+	}
+	if !has || time.Now().Unix() > expireTime {
+		l.keyLock.Unlock(key)
+		return nil, false
+	}
+	value, err := l.memoryValue(data)
+	if err != nil {
+		l.keyLock.Unlock(key)
+		l.onError(err)
+		return nil, false
+	}
+	// set under the same lock, so a set or del after Take is not overwritten
+	l.setLocked(key, value, l.weigh(key, value), expireTime, tags, entryMeta{})
+	if value, err = l.decodeValue(value); err != nil {
+		l.onError(err)
+		return nil, false
+	}
+	return value, true
+}
+
+// takeDisk get key from disk tier and del it, must be called with keyLock of key which is unlocked after take
+func (l *localCache) takeDisk(key string) (interface{}, bool) {
+	data, _, expireTime, has, err := l.disk.Take(key)
+	l.keyLock.Unlock(key)
+	if err != nil {
+		l.onError(err)
+		return nil, false
+	}
+	if !has {
+		return nil, false
+	}
+	l.statist.delIncr()
+	if time.Now().Unix() > expireTime {
+		return nil, false
+	}
+	value, err := l.memoryValue(data)
+	if err == nil {
+		value, err = l.decodeValue(value)
+	}
+	if err != nil {
+		l.onError(err)
+		return nil, false
+	}
+	return value, true
+}
+
+// diskKeys return keys not expired in disk tier which match
+func (l *localCache) diskKeys(match func(key string, tags []string) bool) []string {
+	if l.disk == nil {
+		return nil
+	}
+	var keys []string
+	now := time.Now().Unix()
+	l.disk.Range(func(key string, tags []string, expireTime int64) bool {
+		if now <= expireTime && match(key, tags) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// diskValue return bytes of the value in memory to write to disk,
+// a compressed value is written as is, else it is encoded by codec.
+func (l *localCache) diskValue(value interface{}) ([]byte, error) {
+	if l.compression != nil {
+		return value.([]byte), nil
+	}
+	return l.codec.Marshal(value)
+}
+
+// memoryValue return the value to keep in memory from bytes on disk
+func (l *localCache) memoryValue(data []byte) (interface{}, error) {
+	if l.compression != nil {
+		return data, nil
+	}
+	return l.codec.Unmarshal(data)
+}
+
+// diskProcess run a loop to delete the expired keys and compact segments of disk tier
+func (l *localCache) diskProcess() {
+	defer l.wg.Done()
+	ttlTicker := time.NewTicker(defaultTTLTick * time.Millisecond)
+	defer ttlTicker.Stop()
+	compactTicker := time.NewTicker(defaultDiskCompactTick)
+	defer compactTicker.Stop()
+	for {
+		select {
+		case <-l.stopChan:
+			return
+		case <-l.disk.signal:
+			l.disk.writePending(l.onError)
+		case <-ttlTicker.C:
+			// like ttlProcess, check again if more than 25% are expired
+			ti := time.Now()
+			for time.Since(ti) < defaultTTLCheckRunTime*time.Millisecond {
+				if l.disk.DelExpired(time.Now().Unix(), defaultTTLCheckCount) <= defaultTTLCheckPercent {
+					break
+				}
+			}
+		case <-compactTicker.C:
+			if _, err := l.disk.Compact(time.Now().Unix()); err != nil {
+				l.onError(err)
+			}
+		}
+	}
+}
+
+// hasTag return whether tag is in tags
+func hasTag(tags []string, tag string) bool {
+	for _, one := range tags {
+		if one == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package localcache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MoeYang/go-localcache/datastruct/logstore"
+)
+
+func TestDiskTier(t *testing.T) {
+	c := NewLocalCache(WithCapacity(2), WithStatist(true), WithDiskTier(t.TempDir(), 1<<20))
+	defer c.Stop()
+	c.SetWithTags("a", "1", 100, "tag")
+	c.Set("b", 2)
+	time.Sleep(10 * time.Millisecond)
+	// a is evicted to disk
+	c.Set("c", 3)
+	time.Sleep(10 * time.Millisecond)
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.DiskEntries != 1 || c.Len() != 3 {
+		t.Fatalf("TestDiskTier1 entries %d disk entries %d len %d", stats.Entries, stats.DiskEntries, c.Len())
+	}
+	if ttl, has := c.TTL("a"); !has || ttl <= 98*time.Second {
+		t.Errorf("TestDiskTier2 ttl of a on disk %v, %v", ttl, has)
+	}
+	if v, has := c.Get("a"); !has || v != "1" {
+		t.Errorf("TestDiskTier3 get a = %v, %v", v, has)
+	}
+	time.Sleep(10 * time.Millisecond)
+	// a is promoted and b is evicted
+	stats = c.Stats()
+	if stats.DiskHits != 1 || stats.Entries != 2 || stats.DiskEntries != 1 {
+		t.Errorf("TestDiskTier4 disk hits %d entries %d disk entries %d", stats.DiskHits, stats.Entries, stats.DiskEntries)
+	}
+	// tags are kept on disk
+	c.Set("d", 4)
+	c.Set("e", 5)
+	time.Sleep(10 * time.Millisecond)
+	if n := c.InvalidateTag("tag"); n != 1 {
+		t.Errorf("TestDiskTier5 invalidate tag %d <> 1", n)
+	}
+	if _, has := c.Get("a"); has {
+		t.Error("TestDiskTier6 get a after invalidate")
+	}
+	if !c.Del("b") {
+		t.Error("TestDiskTier7 del b on disk")
+	}
+	c.Flush()
+	if c.Len() != 0 {
+		t.Errorf("TestDiskTier8 len %d after flush", c.Len())
+	}
+}
+
+func TestDiskTierCompression(t *testing.T) {
+	c := NewLocalCache(WithCapacity(1), WithCompression(GzipCompression), WithDiskTier(t.TempDir(), 1<<20))
+	defer c.Stop()
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if v, has := c.Get(strconv.Itoa(i)); !has || v != i {
+			t.Errorf("TestDiskTierCompression get %d = %v, %v", i, v, has)
+		}
+	}
+}
+
+func TestDiskTierPending(t *testing.T) {
+	store, err := logstore.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDiskTier(store)
+	defer d.Close()
+	// a key is pending in memory before written
+	d.Set("a", []byte("1"), []string{"tag"}, 100)
+	if _, has := d.ExpireTime("a"); !has || d.Len() != 1 || store.Len() != 0 {
+		t.Errorf("TestDiskTierPending1 pending a has %v len %d store len %d", has, d.Len(), store.Len())
+	}
+	d.writePending(func(err error) { t.Error(err) })
+	if d.Len() != 1 || store.Len() != 1 || len(d.pending) != 0 {
+		t.Errorf("TestDiskTierPending2 len %d store len %d pending %d", d.Len(), store.Len(), len(d.pending))
+	}
+	// a key deleted before written is not written
+	d.Set("b", []byte("2"), nil, 100)
+	d.Del("b")
+	d.writePending(func(err error) { t.Error(err) })
+	if _, has := store.ExpireTime("b"); has {
+		t.Error("TestDiskTierPending3 deleted b is written")
+	}
+	// a pending key can be taken
+	d.Set("c", []byte("3"), nil, 100)
+	if data, _, _, has, _ := d.Take("c"); !has || string(data) != "3" {
+		t.Errorf("TestDiskTierPending4 take c = %s, %v", data, has)
+	}
+	var keys []string
+	d.Range(func(key string, _ []string, _ int64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("TestDiskTierPending5 keys %v", keys)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	c := NewLocalCache(WithCapacity(2), WithStatist(true), WithDiskTier(t.TempDir(), 1<<20))
+	defer c.Stop()
+	c.Set("a", "1")
+	c.Set("b", 2)
+	time.Sleep(10 * time.Millisecond)
+	// a is evicted to disk
+	c.Set("c", 3)
+	time.Sleep(10 * time.Millisecond)
+	if v, has := c.Peek("a"); !has || v != "1" {
+		t.Errorf("TestPeek1 peek a on disk = %v, %v", v, has)
+	}
+	if v, has := c.Peek("b"); !has || v != 2 {
+		t.Errorf("TestPeek2 peek b = %v, %v", v, has)
+	}
+	if _, has := c.Peek("x"); has {
+		t.Error("TestPeek3 peek x")
+	}
+	time.Sleep(10 * time.Millisecond)
+	// nothing is counted and a is not promoted
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 || stats.DiskHits != 0 || stats.DiskEntries != 1 {
+		t.Errorf("TestPeek4 stats %+v", stats)
+	}
+	ns := c.Namespace("ns", 0)
+	ns.Set("k", 1)
+	if v, has := ns.Peek("k"); !has || v != 1 {
+		t.Errorf("TestPeek5 peek k of namespace = %v, %v", v, has)
+	}
+
+	a := NewArenaCache(1<<16, WithStatist(true))
+	defer a.Stop()
+	a.Set("a", []byte("1"))
+	if v, has := a.Peek("a"); !has || string(v.([]byte)) != "1" || a.Stats().Hits != 0 {
+		t.Errorf("TestPeek6 peek a of arena = %v, %v, hits %d", v, has, a.Stats().Hits)
+	}
+}
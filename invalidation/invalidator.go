@@ -0,0 +1,222 @@
+// Package invalidation broadcast changes of keys to the local caches of other instances.
+//
+//	invalidator := invalidation.New(cache, transport)
+//	invalidator.Set("user:1", user) // other instances delete their copy of user:1
+//	invalidator.InvalidateTag("tenant:2")
+package invalidation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+
+	"github.com/MoeYang/go-localcache"
+)
+
+const (
+	// OpDel delete a key
+	OpDel = "del"
+	// OpInvalidateTag delete keys associated with a tag
+	OpInvalidateTag = "tag"
+	// OpDelPrefix delete keys start with a prefix
+	OpDelPrefix = "prefix"
+	// OpDelMatch delete keys match a glob pattern
+	OpDelMatch = "match"
+	// OpFlush delete all keys
+	OpFlush = "flush"
+)
+
+// Event is an invalidation broadcast to other instances
+type Event struct {
+	Origin string `json:"origin"` // id of the instance which sent the event
+	Op     string `json:"op"`     // one of Op consts
+	Key    string `json:"key"`    // key, tag, prefix or pattern, empty for OpFlush
+}
+
+// Transport deliver msgs to other instances, a transport may deliver msgs to the sender too
+type Transport interface {
+	// Publish send msg to other instances
+	Publish(msg []byte) error
+	// Subscribe set the handler of msgs received
+	Subscribe(handler func(msg []byte))
+	// Close stop receive msgs
+	Close() error
+}
+
+// Invalidator change the local cache and broadcast the change, so other instances delete their stale copies.
+// Every method of Cache which changes keys is wrapped, Invalidate, Touch and Load change the local cache only.
+// Events received are applied to the local cache only and are not broadcast again.
+type Invalidator struct {
+	cache     localcache.Cache
+	transport Transport
+	origin    string
+	onError   func(err error)
+}
+
+// Option of Invalidator
+type Option func(*Invalidator)
+
+// WithOrigin set the id of this instance, default a random id
+func WithOrigin(origin string) Option {
+	return func(i *Invalidator) {
+		if origin != "" {
+			i.origin = origin
+		}
+	}
+}
+
+// WithErrorHandler set the func to handle errors of publish and bad msgs, default log them
+func WithErrorHandler(onError func(err error)) Option {
+	return func(i *Invalidator) {
+		if onError != nil {
+			i.onError = onError
+		}
+	}
+}
+
+// New return an Invalidator of cache which subscribes transport
+func New(cache localcache.Cache, transport Transport, options ...Option) *Invalidator {
+	i := &Invalidator{
+		cache:     cache,
+		transport: transport,
+		origin:    randomID(),
+		onError:   defaultOnError,
+	}
+	for _, opt := range options {
+		opt(i)
+	}
+	transport.Subscribe(i.receive)
+	return i
+}
+
+// Origin return the id of this instance
+func (i *Invalidator) Origin() string {
+	return i.origin
+}
+
+// Set a key-value with default seconds to live, other instances delete key
+func (i *Invalidator) Set(key string, value interface{}) {
+	i.cache.Set(key, value)
+	i.publish(OpDel, key)
+}
+
+// SetWithExpire set a key-value with seconds to live, other instances delete key
+func (i *Invalidator) SetWithExpire(key string, value interface{}, ttl int64) {
+	i.cache.SetWithExpire(key, value, ttl)
+	i.publish(OpDel, key)
+}
+
+// SetWithTags set a key-value with seconds to live and tags, other instances delete key
+func (i *Invalidator) SetWithTags(key string, value interface{}, ttl int64, tags ...string) {
+	i.cache.SetWithTags(key, value, ttl, tags...)
+	i.publish(OpDel, key)
+}
+
+// SetWithOptions set a key-value with options, other instances delete key
+func (i *Invalidator) SetWithOptions(key string, value interface{}, opts localcache.Options) {
+	i.cache.SetWithOptions(key, value, opts)
+	i.publish(OpDel, key)
+}
+
+// CompareAndSwap set a key-value if the version of key is still version, other instances delete key if it is set
+func (i *Invalidator) CompareAndSwap(key string, value interface{}, ttl int64, version uint64) bool {
+	if !i.cache.CompareAndSwap(key, value, ttl, version) {
+		return false
+	}
+	i.publish(OpDel, key)
+	return true
+}
+
+// Del delete key and return if the key exists locally, other instances delete key
+func (i *Invalidator) Del(key string) bool {
+	has := i.cache.Del(key)
+	i.publish(OpDel, key)
+	return has
+}
+
+// GetAndDelete get a key and delete it, other instances delete key
+func (i *Invalidator) GetAndDelete(key string) (interface{}, bool) {
+	value, has := i.cache.GetAndDelete(key)
+	i.publish(OpDel, key)
+	return value, has
+}
+
+// DelPrefix delete keys start with prefix and return count of keys deleted locally, other instances delete them too
+func (i *Invalidator) DelPrefix(prefix string) int {
+	count := i.cache.DelPrefix(prefix)
+	i.publish(OpDelPrefix, prefix)
+	return count
+}
+
+// DelMatch delete keys match the glob pattern and return count of keys deleted locally, other instances delete them too
+func (i *Invalidator) DelMatch(pattern string) int {
+	count := i.cache.DelMatch(pattern)
+	i.publish(OpDelMatch, pattern)
+	return count
+}
+
+// Flush clear all keys, other instances clear all keys too
+func (i *Invalidator) Flush() {
+	i.cache.Flush()
+	i.publish(OpFlush, "")
+}
+
+// InvalidateTag delete keys associated with tag and return count of keys deleted locally,
+// other instances delete keys associated with tag
+func (i *Invalidator) InvalidateTag(tag string) int {
+	count := i.cache.InvalidateTag(tag)
+	i.publish(OpInvalidateTag, tag)
+	return count
+}
+
+// Close the transport
+func (i *Invalidator) Close() error {
+	return i.transport.Close()
+}
+
+func (i *Invalidator) publish(op, key string) {
+	msg, err := json.Marshal(Event{Origin: i.origin, Op: op, Key: key})
+	if err == nil {
+		err = i.transport.Publish(msg)
+	}
+	if err != nil {
+		i.onError(err)
+	}
+}
+
+// receive apply an event from other instances to the local cache only
+func (i *Invalidator) receive(msg []byte) {
+	var event Event
+	if err := json.Unmarshal(msg, &event); err != nil {
+		i.onError(err)
+		return
+	}
+	if event.Origin == i.origin {
+		return
+	}
+	switch event.Op {
+	case OpDel:
+		// the key is changed in backing store by the origin, only del the local copy
+		i.cache.Invalidate(event.Key)
+	case OpInvalidateTag:
+		i.cache.InvalidateTag(event.Key)
+	case OpDelPrefix:
+		i.cache.DelPrefix(event.Key)
+	case OpDelMatch:
+		i.cache.DelMatch(event.Key)
+	case OpFlush:
+		i.cache.Flush()
+	}
+}
+
+// randomID return 16 random hex chars
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func defaultOnError(err error) {
+	log.Printf("localcache/invalidation: %v", err)
+}
@@ -0,0 +1,205 @@
+package invalidation
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MoeYang/go-localcache"
+)
+
+func TestInvalidatorMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+	c1 := localcache.NewLocalCache()
+	defer c1.Stop()
+	c2 := localcache.NewLocalCache()
+	defer c2.Stop()
+	store := localcache.NewMapStore()
+	c3 := localcache.NewLocalCache(localcache.WithBackingStore(store, localcache.WriteThrough))
+	defer c3.Stop()
+	i1 := New(c1, bus.Transport())
+	i2 := New(c2, bus.Transport())
+	i3 := New(c3, bus.Transport())
+	defer i3.Close()
+
+	c2.Set("a", 1)
+	c3.Set("a", 1)
+	i1.Set("a", 2)
+	if v, _ := c1.Get("a"); v != 2 {
+		t.Errorf("TestInvalidatorMemoryBus1 c1 a = %v", v)
+	}
+	if _, has := c2.Get("a"); has {
+		t.Error("TestInvalidatorMemoryBus2 c2 a not invalidated")
+	}
+	// remote events do not delete from backing store
+	if _, has, _ := store.Get("a"); !has {
+		t.Error("TestInvalidatorMemoryBus3 store a deleted by remote event")
+	}
+
+	c1.SetWithTags("b", 1, 0, "t")
+	c2.SetWithTags("c", 1, 0, "t")
+	if n := i2.InvalidateTag("t"); n != 1 {
+		t.Errorf("TestInvalidatorMemoryBus4 invalidate count %d", n)
+	}
+	if _, has := c1.Get("b"); has {
+		t.Error("TestInvalidatorMemoryBus5 c1 b not invalidated")
+	}
+
+	// closed transport receive nothing
+	i2.Close()
+	c2.Set("d", 1)
+	i1.Del("d")
+	if _, has := c2.Get("d"); !has {
+		t.Error("TestInvalidatorMemoryBus6 closed c2 d invalidated")
+	}
+}
+
+// loopTransport deliver msgs to the sender itself
+type loopTransport struct {
+	handler func(msg []byte)
+}
+
+func (l *loopTransport) Publish(msg []byte) error {
+	l.handler(msg)
+	return nil
+}
+
+func (l *loopTransport) Subscribe(handler func(msg []byte)) {
+	l.handler = handler
+}
+
+func (l *loopTransport) Close() error {
+	return nil
+}
+
+func TestInvalidatorSkipOwnEvents(t *testing.T) {
+	c := localcache.NewLocalCache()
+	defer c.Stop()
+	var errs int
+	i := New(c, &loopTransport{}, WithOrigin("me"), WithErrorHandler(func(err error) { errs++ }))
+	i.Set("a", 1)
+	if v, has := c.Get("a"); !has || v != 1 {
+		t.Errorf("TestInvalidatorSkipOwnEvents1 own event applied, a = %v, %v", v, has)
+	}
+	i.receive([]byte("bad"))
+	if errs != 1 {
+		t.Errorf("TestInvalidatorSkipOwnEvents2 errs %d", errs)
+	}
+}
+
+func TestUnixTransport(t *testing.T) {
+	dir := t.TempDir()
+	t1, err := NewUnixTransport(dir, "1")
+	if err != nil {
+		t.Fatalf("TestUnixTransport1 %v", err)
+	}
+	t2, err := NewUnixTransport(dir, "2")
+	if err != nil {
+		t.Fatalf("TestUnixTransport2 %v", err)
+	}
+	c1 := localcache.NewLocalCache()
+	defer c1.Stop()
+	c2 := localcache.NewLocalCache()
+	defer c2.Stop()
+	i1 := New(c1, t1)
+	defer i1.Close()
+	i2 := New(c2, t2)
+
+	c2.Set("a", 1)
+	i1.Del("a")
+	deadline := time.Now().Add(time.Second)
+	for c2.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, has := c2.Get("a"); has {
+		t.Error("TestUnixTransport3 c2 a not invalidated")
+	}
+
+	// socket of a closed instance is skipped
+	i2.Close()
+	if err := t1.Publish([]byte("{}")); err != nil {
+		t.Errorf("TestUnixTransport4 publish %v", err)
+	}
+}
+
+func TestInvalidatorAllWrites(t *testing.T) {
+	bus := NewMemoryBus()
+	c1 := localcache.NewLocalCache()
+	defer c1.Stop()
+	c2 := localcache.NewLocalCache()
+	defer c2.Stop()
+	i1 := New(c1, bus.Transport())
+	New(c2, bus.Transport())
+
+	cases := []struct {
+		name  string
+		keys  []string
+		write func()
+	}{
+		{"SetWithTags", []string{"a"}, func() { i1.SetWithTags("a", 2, 0, "t") }},
+		{"SetWithOptions", []string{"a"}, func() { i1.SetWithOptions("a", 2, localcache.Options{}) }},
+		{"CompareAndSwap", []string{"a"}, func() {
+			_, version, _ := c1.GetWithVersion("a")
+			i1.CompareAndSwap("a", 3, 0, version)
+		}},
+		{"GetAndDelete", []string{"a"}, func() { i1.GetAndDelete("a") }},
+		{"DelPrefix", []string{"p:1", "p:2"}, func() { i1.DelPrefix("p:") }},
+		{"DelMatch", []string{"m:1:x", "m:2:x"}, func() { i1.DelMatch("m:*:x") }},
+		{"Flush", []string{"a", "b"}, func() { i1.Flush() }},
+	}
+	for _, cs := range cases {
+		for _, key := range cs.keys {
+			c1.Set(key, 1)
+			c2.Set(key, 1)
+		}
+		cs.write()
+		for _, key := range cs.keys {
+			if _, has := c2.Get(key); has {
+				t.Errorf("TestInvalidatorAllWrites %s c2 %s not invalidated", cs.name, key)
+			}
+		}
+	}
+	// a failed swap changes nothing and is not broadcast
+	c1.Set("a", 1)
+	c2.Set("a", 1)
+	if i1.CompareAndSwap("a", 2, 0, 0) {
+		t.Error("TestInvalidatorAllWrites swap with a wrong version")
+	}
+	if _, has := c2.Get("a"); !has {
+		t.Error("TestInvalidatorAllWrites c2 a invalidated by a failed swap")
+	}
+}
+
+func TestUnixTransportPeerError(t *testing.T) {
+	dir := t.TempDir()
+	t1, err := NewUnixTransport(dir, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer t1.Close()
+	// a stream socket sorted before the others fails every send
+	bad, err := net.Listen("unix", filepath.Join(dir, "0"+unixSocketExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	t2, err := NewUnixTransport(dir, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer t2.Close()
+	received := make(chan []byte, 1)
+	t2.Subscribe(func(msg []byte) { received <- msg })
+	if err := t1.Publish([]byte("x")); err == nil {
+		t.Error("TestUnixTransportPeerError1 error of bad peer not returned")
+	}
+	select {
+	case msg := <-received:
+		if string(msg) != "x" {
+			t.Errorf("TestUnixTransportPeerError2 received %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("TestUnixTransportPeerError3 peer after the bad one received nothing")
+	}
+}
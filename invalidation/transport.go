@@ -0,0 +1,255 @@
+package invalidation
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// maxMsgSize is the max size of a datagram received
+const maxMsgSize = 64 << 10
+
+// MemoryBus connect MemoryTransports in one process, it is used by tests
+type MemoryBus struct {
+	lock       sync.RWMutex
+	transports []*MemoryTransport
+}
+
+// NewMemoryBus return an empty bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Transport return a new transport connected to the bus
+func (b *MemoryBus) Transport() *MemoryTransport {
+	t := &MemoryTransport{bus: b}
+	b.lock.Lock()
+	b.transports = append(b.transports, t)
+	b.lock.Unlock()
+	return t
+}
+
+// MemoryTransport deliver msgs to the other transports of bus in the publisher goroutine
+type MemoryTransport struct {
+	bus     *MemoryBus
+	lock    sync.RWMutex
+	handler func(msg []byte)
+}
+
+func (t *MemoryTransport) Publish(msg []byte) error {
+	t.bus.lock.RLock()
+	defer t.bus.lock.RUnlock()
+	for _, other := range t.bus.transports {
+		if other != t {
+			other.deliver(msg)
+		}
+	}
+	return nil
+}
+
+func (t *MemoryTransport) Subscribe(handler func(msg []byte)) {
+	t.lock.Lock()
+	t.handler = handler
+	t.lock.Unlock()
+}
+
+// Close remove the transport from bus
+func (t *MemoryTransport) Close() error {
+	t.bus.lock.Lock()
+	defer t.bus.lock.Unlock()
+	for i, other := range t.bus.transports {
+		if other == t {
+			t.bus.transports = append(t.bus.transports[:i], t.bus.transports[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (t *MemoryTransport) deliver(msg []byte) {
+	t.lock.RLock()
+	handler := t.handler
+	t.lock.RUnlock()
+	if handler != nil {
+		handler(msg)
+	}
+}
+
+// receiver read datagrams from conn and call the handler until conn is closed
+type receiver struct {
+	lock    sync.RWMutex
+	handler func(msg []byte)
+	done    chan struct{}
+}
+
+func (r *receiver) Subscribe(handler func(msg []byte)) {
+	r.lock.Lock()
+	r.handler = handler
+	r.lock.Unlock()
+}
+
+func (r *receiver) loop(conn net.PacketConn) {
+	defer close(r.done)
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			// closed
+			return
+		}
+		r.lock.RLock()
+		handler := r.handler
+		r.lock.RUnlock()
+		if handler != nil {
+			msg := make([]byte, n)
+			copy(msg, buf[:n])
+			handler(msg)
+		}
+	}
+}
+
+// UDPTransport send msgs to a multicast group and receive msgs of the group,
+// it receives the msgs sent by itself too, Invalidator skips them by origin.
+type UDPTransport struct {
+	receiver
+	recvConn *net.UDPConn
+	sendConn *net.UDPConn
+}
+
+// NewUDPTransport join the multicast group addr like "239.0.0.1:9999", ifi is the interface to join, nil is the default
+func NewUDPTransport(addr string, ifi *net.Interface) (*UDPTransport, error) {
+	groupAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	recvConn, err := net.ListenMulticastUDP("udp", ifi, groupAddr)
+	if err != nil {
+		return nil, err
+	}
+	sendConn, err := net.DialUDP("udp", nil, groupAddr)
+	if err != nil {
+		recvConn.Close()
+		return nil, err
+	}
+	t := &UDPTransport{
+		receiver: receiver{done: make(chan struct{})},
+		recvConn: recvConn,
+		sendConn: sendConn,
+	}
+	go t.loop(recvConn)
+	return t, nil
+}
+
+func (t *UDPTransport) Publish(msg []byte) error {
+	_, err := t.sendConn.Write(msg)
+	return err
+}
+
+func (t *UDPTransport) Close() error {
+	err := t.recvConn.Close()
+	if errSend := t.sendConn.Close(); err == nil {
+		err = errSend
+	}
+	<-t.done
+	return err
+}
+
+// UnixTransport bind a unixgram socket in dir and send msgs to the sockets of other instances in dir,
+// so instances on one host need no broker. Sockets of dead instances are removed when send to them failed.
+type UnixTransport struct {
+	receiver
+	dir  string
+	path string
+	conn *net.UnixConn
+}
+
+// unixSocketExt is the ext of socket files in dir
+const unixSocketExt = ".sock"
+
+// NewUnixTransport bind socket name.sock in dir, name must be unique among instances like the pid
+func NewUnixTransport(dir, name string) (*UnixTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name+unixSocketExt)
+	// a socket left by a dead instance with same name
+	os.Remove(path)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	t := &UnixTransport{
+		receiver: receiver{done: make(chan struct{})},
+		dir:      dir,
+		path:     path,
+		conn:     conn,
+	}
+	go t.loop(conn)
+	return t, nil
+}
+
+// Publish send msg to all sockets in dir except itself, a failed socket does not stop sending to others
+func (t *UnixTransport) Publish(msg []byte) error {
+	paths, err := filepath.Glob(filepath.Join(t.dir, "*"+unixSocketExt))
+	if err != nil {
+		return err
+	}
+	var errs publishErrors
+	for _, path := range paths {
+		if path == t.path {
+			continue
+		}
+		if _, err := t.conn.WriteToUnix(msg, &net.UnixAddr{Name: path, Net: "unixgram"}); err != nil {
+			if isRefused(err) {
+				// no one listen, the instance is dead
+				os.Remove(path)
+				continue
+			}
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// publishErrors are errors of peers failed in one Publish
+type publishErrors []error
+
+func (e publishErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is report whether any error matches target, so errors.Is works on the errors of all peers
+func (e publishErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close close and remove the socket
+func (t *UnixTransport) Close() error {
+	err := t.conn.Close()
+	<-t.done
+	if errRemove := os.Remove(t.path); err == nil && !os.IsNotExist(errRemove) {
+		err = errRemove
+	}
+	return err
+}
+
+// isRefused return whether err is caused by no socket bound to the address
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT)
+}
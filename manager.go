@@ -0,0 +1,193 @@
+package localcache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCacheExists is returned when create a cache with a name already used
+	ErrCacheExists = errors.New("localcache: cache name already exists")
+	// ErrManagerClosed is returned when create a cache after CloseAll
+	ErrManagerClosed = errors.New("localcache: manager is closed")
+)
+
+// expirer is a cache which deletes expired keys by the ticker of Manager
+type expirer interface {
+	expireTick()
+	isClosed() bool
+}
+
+// Manager create and own named caches with different options, one ticker deletes expired keys of all caches.
+//
+//	manager := localcache.NewManager()
+//	users, _ := manager.Create("users", localcache.WithCapacity(10000))
+//	orders, _ := manager.Create("orders", localcache.WithGlobalTTL(10))
+//	defer manager.CloseAll(context.Background())
+type Manager struct {
+	lock   sync.RWMutex
+	caches map[string]Cache
+	closed bool
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewManager return a Manager and start its ticker
+func NewManager() *Manager {
+	m := &Manager{
+		caches:   make(map[string]Cache),
+		stopChan: make(chan struct{}),
+	}
+	m.wg.Add(1)
+	go m.ttlProcess()
+	return m
+}
+
+// Create a local cache named name with options
+func (m *Manager) Create(name string, options ...Option) (Cache, error) {
+	return m.add(name, func() Cache {
+		return NewLocalCache(append(options[:len(options):len(options)], withSharedTicker())...)
+	})
+}
+
+// CreateArena create an arena cache of size bytes named name with options
+func (m *Manager) CreateArena(name string, size int, options ...Option) (Cache, error) {
+	return m.add(name, func() Cache {
+		return NewArenaCache(size, append(options[:len(options):len(options)], withSharedTicker())...)
+	})
+}
+
+// add a cache created by newCache
+func (m *Manager) add(name string, newCache func() Cache) (Cache, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+	if _, has := m.caches[name]; has {
+		return nil, ErrCacheExists
+	}
+	c := newCache()
+	m.caches[name] = c
+	return c, nil
+}
+
+// Get return the cache named name and if it exists
+func (m *Manager) Get(name string) (Cache, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	c, has := m.caches[name]
+	return c, has
+}
+
+// Names return names of caches sorted
+func (m *Manager) Names() []string {
+	m.lock.RLock()
+	names := make([]string, 0, len(m.caches))
+	for name := range m.caches {
+		names = append(names, name)
+	}
+	m.lock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Remove stop the cache named name and remove it, return if it exists
+func (m *Manager) Remove(name string) bool {
+	m.lock.Lock()
+	c, has := m.caches[name]
+	delete(m.caches, name)
+	m.lock.Unlock()
+	if has {
+		c.Stop()
+	}
+	return has
+}
+
+// Stats return stats of every cache by name
+func (m *Manager) Stats() map[string]Stats {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	stats := make(map[string]Stats, len(m.caches))
+	for name, c := range m.caches {
+		stats[name] = c.Stats()
+	}
+	return stats
+}
+
+// TotalStats return the sum of stats of all caches
+func (m *Manager) TotalStats() Stats {
+	var total Stats
+	for _, stats := range m.Stats() {
+		total = total.Plus(stats)
+	}
+	return total
+}
+
+// CloseAll stop the ticker and close all caches concurrently, return the first error like ctx.Err().
+// Create fails after CloseAll.
+func (m *Manager) CloseAll(ctx context.Context) error {
+	m.lock.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.stopChan)
+	}
+	caches := make([]Cache, 0, len(m.caches))
+	for _, c := range m.caches {
+		caches = append(caches, c)
+	}
+	m.lock.Unlock()
+	m.wg.Wait()
+
+	errs := make(chan error, len(caches))
+	for _, c := range caches {
+		go func(c Cache) {
+			errs <- c.Close(ctx)
+		}(c)
+	}
+	var err error
+	for range caches {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ttlProcess run one loop to delete expired keys of all caches
+func (m *Manager) ttlProcess() {
+	defer m.wg.Done()
+	t := time.NewTicker(defaultTTLTick * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-t.C:
+			m.lock.RLock()
+			caches := make([]expirer, 0, len(m.caches))
+			for _, c := range m.caches {
+				if e, ok := c.(expirer); ok {
+					caches = append(caches, e)
+				}
+			}
+			m.lock.RUnlock()
+			for _, c := range caches {
+				if !c.isClosed() {
+					c.expireTick()
+				}
+			}
+		}
+	}
+}
+
+// withSharedTicker make the cache not start ttlProcess, Manager calls its expireTick
+func withSharedTicker() Option {
+	return func(c *localCache) {
+		c.sharedTicker = true
+	}
+}
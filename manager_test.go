@@ -0,0 +1,62 @@
+package localcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	m := NewManager()
+	users, err := m.Create("users", WithStatist(true))
+	if err != nil {
+		t.Fatalf("TestManager1 create users %v", err)
+	}
+	if _, err := m.Create("users"); err != ErrCacheExists {
+		t.Errorf("TestManager2 create users again err=%v", err)
+	}
+	blobs, err := m.CreateArena("blobs", 1<<20, WithStatist(true))
+	if err != nil {
+		t.Fatalf("TestManager3 create blobs %v", err)
+	}
+	if c, has := m.Get("users"); !has || c != users {
+		t.Error("TestManager4 get users")
+	}
+	if names := m.Names(); len(names) != 2 || names[0] != "blobs" || names[1] != "users" {
+		t.Errorf("TestManager5 names %v", names)
+	}
+
+	users.Set("a", 1)
+	users.Get("a")
+	blobs.Set("b", []byte("1"))
+	blobs.Get("b")
+	blobs.Get("c")
+	total := m.TotalStats()
+	if total.Hits != 2 || total.Misses != 1 || total.Entries != 2 {
+		t.Errorf("TestManager6 total stats %+v", total)
+	}
+	if stats := m.Stats(); stats["users"].Hits != 1 || stats["blobs"].Misses != 1 {
+		t.Errorf("TestManager7 stats %+v", stats)
+	}
+
+	// expired keys are deleted by the shared ticker
+	users.SetWithExpire("x", 1, 1)
+	blobs.SetWithExpire("x", []byte("1"), 1)
+	time.Sleep(2200 * time.Millisecond)
+	if users.Len() != 1 || blobs.Len() != 1 {
+		t.Errorf("TestManager8 expired keys not deleted, len %d %d", users.Len(), blobs.Len())
+	}
+
+	if !m.Remove("blobs") || m.Remove("blobs") {
+		t.Error("TestManager9 remove blobs")
+	}
+	if err := m.CloseAll(context.Background()); err != nil {
+		t.Errorf("TestManager10 close all %v", err)
+	}
+	if _, err := m.Create("orders"); err != ErrManagerClosed {
+		t.Errorf("TestManager11 create after close err=%v", err)
+	}
+	if _, err := users.GetOrLoad("a", func() (interface{}, error) { return 1, nil }); err != ErrClosed {
+		t.Errorf("TestManager12 users not closed, err=%v", err)
+	}
+}
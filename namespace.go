@@ -0,0 +1,495 @@
+package localcache
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// namespaceSep is between the name of namespace and the key, names of namespaces must not contain it
+const namespaceSep = "\x00"
+
+// namePathSep is between the names of a namespace and its sub namespace, it is escaped in every name
+const namePathSep = "/"
+
+var nameEscaper = strings.NewReplacer(`\`, `\\`, namePathSep, `\`+namePathSep)
+
+// escapeName check name of a namespace and escape namePathSep in it,
+// so a sub namespace "b" of "a" never shares keys with the namespace "a/b".
+// It panics if name contains namespaceSep.
+func escapeName(name string) string {
+	if strings.Contains(name, namespaceSep) {
+		panic("localcache: name of namespace contains \"\\x00\": " + strconv.Quote(name))
+	}
+	return nameEscaper.Replace(name)
+}
+
+// namespacer is a cache which can create a namespace by the path of escaped names
+type namespacer interface {
+	namespace(path string, quota int) Cache
+}
+
+// namespace is the state shared by all views of a namespace
+type namespace struct {
+	name   string
+	prefix string // prepended to keys and tags
+	// policy of keys in namespace, nil if no quota, keys are in the policy of cache
+	policy policy
+	// count and weight of keys, only counted by localCache
+	count   int64
+	weight  int64
+	counted bool
+	// total weight of pinned keys, at most maxPinnedWeight if namespace has quota
+	pinnedWeight    int64
+	maxPinnedWeight int64
+	// statist of namespace is always enabled
+	statist statist
+}
+
+func newNamespace(name string) *namespace {
+	return &namespace{
+		name:    name,
+		prefix:  name + namespaceSep,
+		statist: newstatisCaculator(true),
+	}
+}
+
+// add count and weight of keys, ns may be nil
+func (ns *namespace) add(count, weight int64) {
+	if ns == nil {
+		return
+	}
+	atomic.AddInt64(&ns.count, count)
+	atomic.AddInt64(&ns.weight, weight)
+}
+
+// evictIncr add count of keys evicted, ns may be nil
+func (ns *namespace) evictIncr(cause evictionCause) {
+	if ns != nil {
+		ns.statist.evictIncr(cause)
+	}
+}
+
+// unpin sub weight of pinned keys, ns may be nil
+func (ns *namespace) unpin(weight int64) {
+	if ns != nil {
+		atomic.AddInt64(&ns.pinnedWeight, -weight)
+	}
+}
+
+// expireIncr add count of keys expired, ns may be nil
+func (ns *namespace) expireIncr() {
+	if ns != nil {
+		ns.statist.expireIncr()
+	}
+}
+
+// namespaces is the registry of namespaces of a cache, namespaces are never removed
+type namespaces struct {
+	lock sync.RWMutex
+	m    map[string]*namespace
+	// has is 1 once a namespace is created, so caches without namespaces skip the lookup
+	has int32
+	// quota is 1 once a namespace with quota is created, then cacheProcess checks the capacity for keys of all policies
+	quota int32
+}
+
+// get return the namespace named name, create it by newNamespace if not exists
+func (n *namespaces) get(name string, newNamespace func() *namespace) *namespace {
+	n.lock.RLock()
+	ns, has := n.m[name]
+	n.lock.RUnlock()
+	if has {
+		return ns
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if ns, has = n.m[name]; has {
+		return ns
+	}
+	if n.m == nil {
+		n.m = make(map[string]*namespace)
+	}
+	ns = newNamespace()
+	n.m[name] = ns
+	atomic.StoreInt32(&n.has, 1)
+	return ns
+}
+
+// of return the namespace which key belongs to, nil if not in a namespace
+func (n *namespaces) of(key string) *namespace {
+	if atomic.LoadInt32(&n.has) == 0 {
+		return nil
+	}
+	i := strings.Index(key, namespaceSep)
+	if i < 0 {
+		return nil
+	}
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.m[key[:i]]
+}
+
+// list return all namespaces
+func (n *namespaces) list() []*namespace {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	list := make([]*namespace, 0, len(n.m))
+	for _, ns := range n.m {
+		list = append(list, ns)
+	}
+	return list
+}
+
+// flush clear policies and counters of namespaces, called by flush of localCache
+func (n *namespaces) flush() {
+	for _, ns := range n.list() {
+		if ns.policy != nil {
+			ns.policy.flush()
+		}
+		atomic.StoreInt64(&ns.count, 0)
+		atomic.StoreInt64(&ns.weight, 0)
+		atomic.StoreInt64(&ns.pinnedWeight, 0)
+	}
+}
+
+// Namespace return a view of cache whose keys are isolated from other namespaces.
+// Keys of a namespace with quota > 0 are evicted by their own policy when their weight is over quota,
+// and at most half of quota can be pinned. They are still counted by the capacity of cache:
+// when the cache is full, keys not in namespaces with quota are evicted first, then keys of the namespace being set,
+// so a namespace never evicts keys of other namespaces with quota. With WithShardedPolicy keys not in namespaces
+// are in shard policies, so keys of a namespace only evict keys of the namespace.
+// The namespace is created by the first call, quota of later calls is ignored.
+// It panics if name contains "\x00".
+func (l *localCache) Namespace(name string, quota int) Cache {
+	return l.namespace(escapeName(name), quota)
+}
+
+func (l *localCache) namespace(path string, quota int) Cache {
+	ns := l.namespaces.get(path, func() *namespace {
+		ns := newNamespace(path)
+		ns.counted = true
+		if quota > 0 {
+			ns.policy = newPolicy(l.policyType, quota, l.evict, l.canEvict)
+			ns.maxPinnedWeight = int64(quota) / 2
+			atomic.StoreInt32(&l.namespaces.quota, 1)
+		}
+		return ns
+	})
+	return &namespaceView{cache: l, ns: ns}
+}
+
+// fitCapacity called by cacheProcess with policyLock after an obj is added to policy p.
+// Evict keys until the weight of cache is not over capacity, keys not in namespaces with quota are evicted first,
+// then keys of p if p is a policy of namespace, else keys of the heaviest namespace.
+func (l *localCache) fitCapacity(p policy) {
+	if atomic.LoadInt32(&l.namespaces.quota) == 0 {
+		// the policy of cache keeps the capacity itself
+		return
+	}
+	for atomic.LoadInt64(&l.weight) > int64(l.cap) {
+		if l.policy.evictOne() {
+			continue
+		}
+		if p != l.policy {
+			// a namespace never evicts keys of other namespaces
+			if !p.evictOne() {
+				return
+			}
+			continue
+		}
+		if !l.evictHeaviest() {
+			// all keys left are pinned
+			return
+		}
+	}
+}
+
+// evictHeaviest evict a key of the heaviest namespace with quota which has a key can be evicted, return false if none
+func (l *localCache) evictHeaviest() bool {
+	list := l.namespaces.list()
+	sort.Slice(list, func(i, j int) bool {
+		return atomic.LoadInt64(&list[i].weight) > atomic.LoadInt64(&list[j].weight)
+	})
+	for _, ns := range list {
+		if ns.policy != nil && ns.policy.evictOne() {
+			return true
+		}
+	}
+	return false
+}
+
+// policyOf return the policy which obj belongs to
+func (l *localCache) policyOf(obj interface{}) policy {
+	if ns := l.policy.unpack(obj).ns; ns != nil && ns.policy != nil {
+		return ns.policy
+	}
+	return l.policy
+}
+
+// inQuota return whether obj is in a namespace with quota
+func (l *localCache) inQuota(obj interface{}) bool {
+	ns := l.policy.unpack(obj).ns
+	return ns != nil && ns.policy != nil
+}
+
+// Namespace return a view of cache whose keys are isolated from other namespaces.
+// Arena cache ignores quota, keys of all namespaces share the ring buffers. It panics if name contains "\x00".
+func (c *arenaCache) Namespace(name string, quota int) Cache {
+	return c.namespace(escapeName(name), quota)
+}
+
+func (c *arenaCache) namespace(path string, quota int) Cache {
+	ns := c.namespaces.get(path, func() *namespace {
+		return newNamespace(path)
+	})
+	return &namespaceView{cache: c, ns: ns}
+}
+
+// prefixSaver is a cache which can save and load the keys of a namespace
+type prefixSaver interface {
+	savePrefix(w io.Writer, prefix string) error
+	loadPrefix(r io.Reader, prefix string) error
+}
+
+// namespaceView is a Cache of keys in a namespace, it adds the prefix of namespace to keys and tags
+type namespaceView struct {
+	cache Cache
+	ns    *namespace
+}
+
+func (v *namespaceView) key(key string) string {
+	return v.ns.prefix + key
+}
+
+func (v *namespaceView) tags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(tags))
+	for i, tag := range tags {
+		prefixed[i] = v.ns.prefix + tag
+	}
+	return prefixed
+}
+
+func (v *namespaceView) Get(key string) (interface{}, bool) {
+	value, has := v.cache.Get(v.key(key))
+	v.countGet(has)
+	return value, has
+}
+
+// Peek is not counted by stats of namespace
+func (v *namespaceView) Peek(key string) (interface{}, bool) {
+	return v.cache.Peek(v.key(key))
+}
+
+func (v *namespaceView) GetOrLoad(key string, f LoadFunc) (interface{}, error) {
+	var loaded bool
+	value, err := v.cache.GetOrLoad(v.key(key), func() (interface{}, error) {
+		loaded = true
+		start := time.Now()
+		value, err := f()
+		v.ns.statist.loadIncr(time.Since(start), err)
+		return value, err
+	})
+	v.countGet(!loaded && err == nil)
+	return value, err
+}
+
+func (v *namespaceView) Set(key string, value interface{}) {
+	v.ns.statist.setIncr()
+	v.cache.Set(v.key(key), value)
+}
+
+func (v *namespaceView) SetWithExpire(key string, value interface{}, ttl int64) {
+	v.ns.statist.setIncr()
+	v.cache.SetWithExpire(v.key(key), value, ttl)
+}
+
+func (v *namespaceView) SetWithTags(key string, value interface{}, ttl int64, tags ...string) {
+	v.ns.statist.setIncr()
+	v.cache.SetWithTags(v.key(key), value, ttl, v.tags(tags)...)
+}
+
+func (v *namespaceView) InvalidateTag(tag string) int {
+	return v.cache.InvalidateTag(v.ns.prefix + tag)
+}
+
+func (v *namespaceView) Del(key string) bool {
+	_, has := v.GetAndDelete(key)
+	return has
+}
+
+func (v *namespaceView) Invalidate(key string) bool {
+	return v.cache.Invalidate(v.key(key))
+}
+
+func (v *namespaceView) GetWithVersion(key string) (interface{}, uint64, bool) {
+	value, version, has := v.cache.GetWithVersion(v.key(key))
+	v.countGet(has)
+	return value, version, has
+}
+
+func (v *namespaceView) CompareAndSwap(key string, value interface{}, ttl int64, version uint64) bool {
+	if !v.cache.CompareAndSwap(v.key(key), value, ttl, version) {
+		return false
+	}
+	v.ns.statist.setIncr()
+	return true
+}
+
+func (v *namespaceView) GetAndDelete(key string) (interface{}, bool) {
+	value, has := v.cache.GetAndDelete(v.key(key))
+	if has {
+		v.ns.statist.delIncr()
+	}
+	return value, has
+}
+
+func (v *namespaceView) DelPrefix(prefix string) int {
+	return v.cache.DelPrefix(v.ns.prefix + prefix)
+}
+
+func (v *namespaceView) DelMatch(pattern string) int {
+	return v.cache.DelMatch(escapeGlob(v.ns.prefix) + pattern)
+}
+
+func (v *namespaceView) GetMulti(keys []string) map[string]interface{} {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = v.key(key)
+	}
+	values := v.cache.GetMulti(prefixed)
+	res := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		res[strings.TrimPrefix(key, v.ns.prefix)] = value
+	}
+	for _, key := range keys {
+		_, has := res[key]
+		v.countGet(has)
+	}
+	return res
+}
+
+func (v *namespaceView) TTL(key string) (time.Duration, bool) {
+	return v.cache.TTL(v.key(key))
+}
+
+func (v *namespaceView) Touch(key string, ttl int64) bool {
+	return v.cache.Touch(v.key(key), ttl)
+}
+
+// Keys return all keys not expired in namespace, without the prefix of namespace
+func (v *namespaceView) Keys() []string {
+	var keys []string
+	for _, key := range v.cache.Keys() {
+		if strings.HasPrefix(key, v.ns.prefix) {
+			keys = append(keys, key[len(v.ns.prefix):])
+		}
+	}
+	return keys
+}
+
+// Len return count of keys in namespace
+func (v *namespaceView) Len() int {
+	if v.ns.counted {
+		return int(atomic.LoadInt64(&v.ns.count))
+	}
+	return len(v.Keys())
+}
+
+// Flush delete all keys in namespace from cache only
+func (v *namespaceView) Flush() {
+	for _, key := range v.Keys() {
+		v.cache.Invalidate(v.key(key))
+	}
+}
+
+// Close do nothing, the cache is closed by its owner
+func (v *namespaceView) Close(ctx context.Context) error {
+	return nil
+}
+
+// Stop do nothing, the cache is stopped by its owner
+func (v *namespaceView) Stop() {}
+
+func (v *namespaceView) Statistic() map[string]interface{} {
+	var stats Stats
+	v.ns.statist.fill(&stats)
+	return map[string]interface{}{
+		"hit":        stats.Hits,
+		"miss":       stats.Misses,
+		"hitRate":    v.ns.statist.GetHitRate(),
+		"hitRate1m":  stats.Last1m.HitRate(),
+		"hitRate5m":  stats.Last5m.HitRate(),
+		"hitRate15m": stats.Last15m.HitRate(),
+	}
+}
+
+// Stats return statistic of namespace, gauges of the cache like QueueDepth are not set
+func (v *namespaceView) Stats() Stats {
+	var stats Stats
+	v.ns.statist.fill(&stats)
+	stats.Entries = v.Len()
+	stats.Weight = atomic.LoadInt64(&v.ns.weight)
+	stats.PinnedWeight = atomic.LoadInt64(&v.ns.pinnedWeight)
+	return stats
+}
+
+// TopKeys return at most k hottest keys of namespace
+func (v *namespaceView) TopKeys(k int) []KeyCount {
+	var keys []KeyCount
+	for _, kc := range v.cache.TopKeys(-1) {
+		if k >= 0 && len(keys) == k {
+			break
+		}
+		if strings.HasPrefix(kc.Key, v.ns.prefix) {
+			keys = append(keys, KeyCount{Key: kc.Key[len(v.ns.prefix):], Count: kc.Count})
+		}
+	}
+	return keys
+}
+
+// Save write keys of namespace to w without the prefix, so they can be loaded to another namespace or cache
+func (v *namespaceView) Save(w io.Writer) error {
+	return v.cache.(prefixSaver).savePrefix(w, v.ns.prefix)
+}
+
+// Load read keys written by Save and set them to namespace
+func (v *namespaceView) Load(r io.Reader) error {
+	return v.cache.(prefixSaver).loadPrefix(r, v.ns.prefix)
+}
+
+// Namespace return a namespace named sub in this namespace, it panics if sub contains "\x00"
+func (v *namespaceView) Namespace(sub string, quota int) Cache {
+	return v.cache.(namespacer).namespace(v.ns.name+namePathSep+escapeName(sub), quota)
+}
+
+func (v *namespaceView) countGet(has bool) {
+	if has {
+		v.ns.statist.hitIncr()
+	} else {
+		v.ns.statist.missIncr()
+	}
+}
+
+// escapeGlob escape the special chars of glob pattern in s
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, "*?[\\") {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune("*?[\\", c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
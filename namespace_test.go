@@ -0,0 +1,196 @@
+package localcache
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	for _, sharded := range []bool{false, true} {
+		c := NewLocalCache(WithCapacity(100), WithShardedPolicy(sharded)).(*localCache)
+		quiet := c.Namespace("quiet", 10)
+		noisy := c.Namespace("noisy", 10)
+		for i := 0; i < 5; i++ {
+			quiet.Set(strconv.Itoa(i), i)
+		}
+		for i := 0; i < 50; i++ {
+			noisy.Set(strconv.Itoa(i), i)
+		}
+		// wait cacheProcess apply the adds
+		c.snapshot()
+		if quiet.Len() != 5 {
+			t.Errorf("TestNamespace1 sharded=%v quiet keys evicted, len=%d", sharded, quiet.Len())
+		}
+		if noisy.Len() != 10 {
+			t.Errorf("TestNamespace2 sharded=%v noisy over quota, len=%d", sharded, noisy.Len())
+		}
+		if v, has := noisy.Get("49"); !has || v != 49 {
+			t.Errorf("TestNamespace3 sharded=%v newest key of noisy %v %v", sharded, v, has)
+		}
+		if stats := noisy.Stats(); stats.Evictions.Capacity != 40 || stats.Entries != 10 {
+			t.Errorf("TestNamespace4 sharded=%v noisy stats %+v", sharded, stats)
+		}
+		if stats := quiet.Stats(); stats.Evictions.Capacity != 0 || stats.Sets != 5 {
+			t.Errorf("TestNamespace5 sharded=%v quiet stats %+v", sharded, stats)
+		}
+		c.Stop()
+	}
+}
+
+func TestNamespaceCapacity(t *testing.T) {
+	for _, sharded := range []bool{false, true} {
+		c := NewLocalCache(WithCapacity(20), WithShardedPolicy(sharded)).(*localCache)
+		quiet := c.Namespace("quiet", 10)
+		noisy := c.Namespace("noisy", 15)
+		for i := 0; i < 5; i++ {
+			quiet.Set(strconv.Itoa(i), i)
+		}
+		for i := 0; i < 50; i++ {
+			c.Set(strconv.Itoa(i), i)
+			noisy.Set(strconv.Itoa(i), i)
+			c.snapshot()
+			// quotas are counted by the capacity of cache
+			if weight := c.Stats().Weight; weight > 20 {
+				t.Fatalf("TestNamespaceCapacity1 sharded=%v weight %d over capacity after %d sets", sharded, weight, i)
+			}
+		}
+		if quiet.Len() != 5 {
+			t.Errorf("TestNamespaceCapacity2 sharded=%v quiet keys evicted, len=%d", sharded, quiet.Len())
+		}
+		if n := noisy.Len(); n == 0 || n > 15 {
+			t.Errorf("TestNamespaceCapacity3 sharded=%v noisy len=%d", sharded, n)
+		}
+		c.Stop()
+	}
+}
+
+func TestNamespacePinned(t *testing.T) {
+	c := NewLocalCache(WithCapacity(100)).(*localCache)
+	defer c.Stop()
+	a := c.Namespace("a", 10)
+	b := c.Namespace("b", 0)
+	for i := 0; i < 10; i++ {
+		a.SetWithOptions(strconv.Itoa(i), i, Options{Pinned: true})
+		b.SetWithOptions(strconv.Itoa(i), i, Options{Pinned: true})
+	}
+	// at most half of quota is pinned
+	if pinned := a.Stats().PinnedWeight; pinned != 5 {
+		t.Errorf("TestNamespacePinned1 a pinned weight %d <> 5", pinned)
+	}
+	if pinned := b.Stats().PinnedWeight; pinned != 10 {
+		t.Errorf("TestNamespacePinned2 b pinned weight %d <> 10", pinned)
+	}
+	if pinned := c.Stats().PinnedWeight; pinned != 15 {
+		t.Errorf("TestNamespacePinned3 pinned weight %d <> 15", pinned)
+	}
+	a.Del("0")
+	if pinned := a.Stats().PinnedWeight; pinned != 4 {
+		t.Errorf("TestNamespacePinned4 a pinned weight %d <> 4 after del", pinned)
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	c := NewLocalCache(WithPrefixIndex(true))
+	defer c.Stop()
+	a := c.Namespace("a", 0)
+	b := c.Namespace("b", 0)
+	a.SetWithTags("k", 1, 60, "t")
+	b.SetWithTags("k", 2, 60, "t")
+	c.Set("k", 3)
+	if v, _ := a.Get("k"); v != 1 {
+		t.Errorf("TestNamespaceIsolation1 a get %v", v)
+	}
+	if v, _ := b.Get("k"); v != 2 {
+		t.Errorf("TestNamespaceIsolation2 b get %v", v)
+	}
+	if keys := a.Keys(); len(keys) != 1 || keys[0] != "k" {
+		t.Errorf("TestNamespaceIsolation3 a keys %v", keys)
+	}
+	if n := a.InvalidateTag("t"); n != 1 {
+		t.Errorf("TestNamespaceIsolation4 invalidate tag %d", n)
+	}
+	if _, has := b.Get("k"); !has {
+		t.Error("TestNamespaceIsolation5 b deleted by tag of a")
+	}
+	b.Set("x*", 1)
+	if n := b.DelMatch("x*"); n != 1 {
+		t.Errorf("TestNamespaceIsolation6 del match %d", n)
+	}
+	if c.Len() != 2 {
+		t.Errorf("TestNamespaceIsolation7 len %d", c.Len())
+	}
+	if stats := a.Stats(); stats.Hits != 1 || stats.Misses != 0 || stats.Entries != 0 {
+		t.Errorf("TestNamespaceIsolation8 a stats %+v", stats)
+	}
+
+	// keys are saved without the prefix and can be loaded to another namespace
+	b.Set("y", 4)
+	var buf bytes.Buffer
+	if err := b.Save(&buf); err != nil {
+		t.Fatalf("TestNamespaceIsolation9 save %v", err)
+	}
+	d := c.Namespace("d", 0)
+	if err := d.Load(&buf); err != nil {
+		t.Fatalf("TestNamespaceIsolation10 load %v", err)
+	}
+	if v, _ := d.Get("y"); v != 4 || d.Len() != 2 {
+		t.Errorf("TestNamespaceIsolation11 load y=%v len=%d", v, d.Len())
+	}
+	d.Flush()
+	if d.Len() != 0 || b.Len() != 2 {
+		t.Errorf("TestNamespaceIsolation12 flush len %d %d", d.Len(), b.Len())
+	}
+}
+
+func TestNamespaceArena(t *testing.T) {
+	c := NewArenaCache(1 << 20)
+	defer c.Stop()
+	a := c.Namespace("a", 100)
+	a.Set("k", []byte("1"))
+	c.Set("k", []byte("2"))
+	if v, _ := a.Get("k"); string(v.([]byte)) != "1" {
+		t.Errorf("TestNamespaceArena1 get %v", v)
+	}
+	if a.Len() != 1 || c.Len() != 2 {
+		t.Errorf("TestNamespaceArena2 len %d %d", a.Len(), c.Len())
+	}
+}
+
+func TestNamespaceNames(t *testing.T) {
+	for i, c := range []Cache{NewLocalCache(), NewArenaCache(1 << 20)} {
+		// a sub namespace never shares keys with a namespace whose name contains "/"
+		sub := c.Namespace("a", 0).Namespace("b", 0)
+		slash := c.Namespace("a/b", 0)
+		sub.Set("k", []byte("1"))
+		slash.Set("k", []byte("2"))
+		if v, _ := sub.Get("k"); string(v.([]byte)) != "1" {
+			t.Errorf("TestNamespaceNames%d sub get %v", i, v)
+		}
+		if v, _ := c.Namespace("a", 0).Namespace("b", 0).Get("k"); string(v.([]byte)) != "1" {
+			t.Errorf("TestNamespaceNames%d sub again get %v", i, v)
+		}
+		if sub.Len() != 1 || slash.Len() != 1 {
+			t.Errorf("TestNamespaceNames%d len %d %d", i, sub.Len(), slash.Len())
+		}
+		for _, name := range []string{"x\x00y", "\x00"} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("TestNamespaceNames%d name %q accepted", i, name)
+					}
+				}()
+				c.Namespace("a", 0).Namespace(name, 0)
+			}()
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("TestNamespaceNames%d name %q accepted", i, name)
+					}
+				}()
+				c.Namespace(name, 0)
+			}()
+		}
+		c.Stop()
+	}
+}
@@ -0,0 +1,231 @@
+// Package peers load every key once per cluster like groupcache: a consistent hash ring decides the peer owns a key,
+// GetOrLoad of a key owned by another peer fetches it from the owner by http instead of calling the loader,
+// and keeps a hot copy for a short time.
+//
+//	pool := peers.New("http://10.0.0.1:8080", cache, loadUser)
+//	pool.Set("http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080")
+//	mux.Handle(peers.DefaultBasePath, pool)
+//	user, err := pool.Get("user:1")
+package peers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MoeYang/go-localcache"
+)
+
+const (
+	// DefaultBasePath is the path peers serve keys
+	DefaultBasePath = "/_localcache/peers"
+
+	defaultReplicas = 50
+	defaultHotCap   = 1024
+	defaultHotTTL   = 10 // seconds
+	defaultTimeout  = 3 * time.Second
+)
+
+// Loader load the value of key from user storage, it is called by the owner of key
+type Loader func(key string) (interface{}, error)
+
+// Pool is a peer of the cluster, it serves keys it owns to other peers and fetches keys owned by other peers
+type Pool struct {
+	self   string
+	cache  localcache.Cache // keys owned by self
+	hot    localcache.Cache // hot copies of keys owned by other peers
+	loader Loader
+
+	lock sync.RWMutex
+	ring *Ring
+
+	replicas int
+	basePath string
+	codec    localcache.Codec
+	client   *http.Client
+	onError  func(err error)
+	ownHot   bool // hot cache is created by pool, stop it when close
+}
+
+// Option of Pool
+type Option func(*Pool)
+
+// WithReplicas set count of virtual nodes of every peer on ring, default 50
+func WithReplicas(replicas int) Option {
+	return func(p *Pool) {
+		p.replicas = replicas
+	}
+}
+
+// WithHotCache set the cache keeps hot copies of keys owned by other peers,
+// default a cache of 1024 keys live 10 seconds
+func WithHotCache(hot localcache.Cache) Option {
+	return func(p *Pool) {
+		if hot != nil {
+			p.hot = hot
+		}
+	}
+}
+
+// WithBasePath set the path peers serve keys, default DefaultBasePath
+func WithBasePath(basePath string) Option {
+	return func(p *Pool) {
+		if basePath != "" {
+			p.basePath = basePath
+		}
+	}
+}
+
+// WithCodec set the codec to transfer values between peers, default localcache.GobCodec
+func WithCodec(codec localcache.Codec) Option {
+	return func(p *Pool) {
+		if codec != nil {
+			p.codec = codec
+		}
+	}
+}
+
+// WithHTTPClient set the client to fetch from peers, default a client with 3s timeout
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Pool) {
+		if client != nil {
+			p.client = client
+		}
+	}
+}
+
+// WithErrorHandler set the func to handle errors of fetching from peers, default log them
+func WithErrorHandler(onError func(err error)) Option {
+	return func(p *Pool) {
+		if onError != nil {
+			p.onError = onError
+		}
+	}
+}
+
+// New return a Pool of peer self, self is the base url of this peer like "http://10.0.0.1:8080".
+// cache keeps keys owned by self, loader loads them when other peers ask for them.
+func New(self string, cache localcache.Cache, loader Loader, options ...Option) *Pool {
+	p := &Pool{
+		self:     self,
+		cache:    cache,
+		loader:   loader,
+		replicas: defaultReplicas,
+		basePath: DefaultBasePath,
+		codec:    localcache.GobCodec,
+		client:   &http.Client{Timeout: defaultTimeout},
+		onError:  defaultOnError,
+	}
+	for _, opt := range options {
+		opt(p)
+	}
+	if p.hot == nil {
+		p.hot = localcache.NewLocalCache(localcache.WithCapacity(defaultHotCap), localcache.WithGlobalTTL(defaultHotTTL))
+		p.ownHot = true
+	}
+	p.ring = NewRing(p.replicas, self)
+	return p
+}
+
+// Set replace the peers of cluster, peers are base urls and should include self
+func (p *Pool) Set(peers ...string) {
+	ring := NewRing(p.replicas, peers...)
+	p.lock.Lock()
+	p.ring = ring
+	p.lock.Unlock()
+}
+
+// Owner return the peer owns key
+func (p *Pool) Owner(key string) string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.ring.Get(key)
+}
+
+// Get a key, load it by loader if self owns it
+func (p *Pool) Get(key string) (interface{}, error) {
+	return p.GetOrLoad(key, p.loadFunc(key))
+}
+
+// GetOrLoad get a key, while self owns it and it not exists, call f() to load data.
+// A key owned by another peer is fetched from that peer and kept in hot cache,
+// f() is called only when the peer failed.
+func (p *Pool) GetOrLoad(key string, f localcache.LoadFunc) (interface{}, error) {
+	owner := p.Owner(key)
+	if owner == "" || owner == p.self {
+		return p.cache.GetOrLoad(key, f)
+	}
+	return p.hot.GetOrLoad(key, func() (interface{}, error) {
+		value, err := p.fetch(owner, key)
+		if err != nil {
+			p.onError(err)
+			return f()
+		}
+		return value, nil
+	})
+}
+
+// Close stop the hot cache created by pool
+func (p *Pool) Close() {
+	if p.ownHot {
+		p.hot.Stop()
+	}
+}
+
+// ServeHTTP serve keys to other peers: GET basePath?key=
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, p.basePath) {
+		http.NotFound(w, r)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	// serve from the owner cache even if ring changed, the peer asks for it thinks self owns it
+	value, err := p.cache.GetOrLoad(key, p.loadFunc(key))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := p.codec.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// fetch key from peer
+func (p *Pool) fetch(peer, key string) (interface{}, error) {
+	resp, err := p.client.Get(peer + p.basePath + "?key=" + url.QueryEscape(key))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("localcache/peers: peer %s get %q: %s %s", peer, key, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return p.codec.Unmarshal(data)
+}
+
+func (p *Pool) loadFunc(key string) localcache.LoadFunc {
+	return func() (interface{}, error) {
+		return p.loader(key)
+	}
+}
+
+func defaultOnError(err error) {
+	log.Printf("localcache/peers: %v", err)
+}
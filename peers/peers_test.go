@@ -0,0 +1,93 @@
+package peers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MoeYang/go-localcache"
+)
+
+// newCluster start n peers on httptest servers, loads counts calls of loader of all peers
+func newCluster(t *testing.T, n int, loads *int64) []*Pool {
+	pools := make([]*Pool, n)
+	urls := make([]string, n)
+	for i := range pools {
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		urls[i] = server.URL
+	}
+	for i := range pools {
+		cache := localcache.NewLocalCache()
+		t.Cleanup(cache.Stop)
+		pools[i] = New(urls[i], cache, func(key string) (interface{}, error) {
+			atomic.AddInt64(loads, 1)
+			return "v" + key, nil
+		})
+		t.Cleanup(pools[i].Close)
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+	return pools
+}
+
+func TestPoolLoadOncePerCluster(t *testing.T) {
+	var loads int64
+	pools := newCluster(t, 3, &loads)
+	for i := 0; i < 30; i++ {
+		key := strconv.Itoa(i)
+		for _, p := range pools {
+			v, err := p.Get(key)
+			if err != nil || v != "v"+key {
+				t.Fatalf("TestPoolLoadOncePerCluster1 get %s = %v, %v", key, v, err)
+			}
+		}
+	}
+	if loads != 30 {
+		t.Errorf("TestPoolLoadOncePerCluster2 loads %d", loads)
+	}
+	// keys owned by other peers are kept in hot cache
+	var remote int
+	for i := 0; i < 30; i++ {
+		key := strconv.Itoa(i)
+		if pools[0].Owner(key) != pools[0].self {
+			remote++
+			if _, has := pools[0].hot.Get(key); !has {
+				t.Errorf("TestPoolLoadOncePerCluster3 %s not in hot cache", key)
+			}
+		} else if _, has := pools[0].cache.Get(key); !has {
+			t.Errorf("TestPoolLoadOncePerCluster4 %s not in cache", key)
+		}
+	}
+	if remote == 0 {
+		t.Error("TestPoolLoadOncePerCluster5 no key owned by other peers")
+	}
+}
+
+func TestPoolPeerError(t *testing.T) {
+	var loads int64
+	pools := newCluster(t, 2, &loads)
+	var errs int
+	pools[0].onError = func(err error) { errs++ }
+	// a key owned by peer 1
+	key := "0"
+	for i := 1; pools[0].Owner(key) != pools[1].self; i++ {
+		key = strconv.Itoa(i)
+	}
+	pools[1].loader = func(key string) (interface{}, error) { return nil, errors.New("load failed") }
+	// the owner failed, load locally
+	v, err := pools[0].GetOrLoad(key, func() (interface{}, error) { return "local", nil })
+	if err != nil || v != "local" {
+		t.Errorf("TestPoolPeerError1 get %s = %v, %v", key, v, err)
+	}
+	if errs != 1 {
+		t.Errorf("TestPoolPeerError2 errs %d", errs)
+	}
+}
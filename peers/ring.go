@@ -0,0 +1,88 @@
+package peers
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/MoeYang/go-localcache/common"
+)
+
+// Ring is a consistent hash ring of nodes, every node has replicas virtual nodes on ring.
+// Adding or removing a node only moves the keys of that node. Ring is not safe for concurrent use.
+type Ring struct {
+	replicas int
+	hashes   []uint64          // sorted hashes of virtual nodes
+	nodes    map[uint64]string // hash of virtual node to node
+}
+
+// NewRing return a ring with nodes, replicas <= 0 means defaultReplicas
+func NewRing(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	r := &Ring{
+		replicas: replicas,
+		nodes:    make(map[uint64]string),
+	}
+	r.Add(nodes...)
+	return r
+}
+
+// Add nodes to ring
+func (r *Ring) Add(nodes ...string) {
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			hash := hashKey(strconv.Itoa(i) + node)
+			if _, has := r.nodes[hash]; has {
+				continue
+			}
+			r.nodes[hash] = node
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Remove node from ring
+func (r *Ring) Remove(node string) {
+	hashes := r.hashes[:0]
+	for _, hash := range r.hashes {
+		if r.nodes[hash] == node {
+			delete(r.nodes, hash)
+		} else {
+			hashes = append(hashes, hash)
+		}
+	}
+	r.hashes = hashes
+}
+
+// Get return the node owns key, "" if ring is empty
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	// the first virtual node clockwise
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
+
+// Len return count of virtual nodes
+func (r *Ring) Len() int {
+	return len(r.hashes)
+}
+
+// hashKey return the position of key on ring.
+// fnv-1a of short or similar keys are close, the murmur3 finalizer spreads them over the ring.
+func hashKey(key string) uint64 {
+	h := common.Hash64(key)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
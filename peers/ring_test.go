@@ -0,0 +1,58 @@
+package peers
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(0)
+	if node := r.Get("a"); node != "" {
+		t.Errorf("TestRing1 empty ring get %q", node)
+	}
+	r.Add("n1", "n2", "n3")
+	if r.Len() != 3*defaultReplicas {
+		t.Errorf("TestRing2 len %d", r.Len())
+	}
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = r.Get(key)
+		counts[owners[key]]++
+	}
+	for _, node := range []string{"n1", "n2", "n3"} {
+		if counts[node] < 500 {
+			t.Errorf("TestRing3 node %s owns %d keys", node, counts[node])
+		}
+	}
+	// only keys of removed node move
+	r.Remove("n2")
+	for key, owner := range owners {
+		if node := r.Get(key); owner != "n2" && node != owner || node == "n2" {
+			t.Fatalf("TestRing4 key %s moved from %s to %s", key, owner, node)
+		}
+	}
+}
+
+func TestRingDistribution(t *testing.T) {
+	// nodes like the addresses of peers on one host, keys are short and sequential
+	for port := 40000; port < 40600; port += 3 {
+		r := NewRing(0)
+		for i := 0; i < 3; i++ {
+			r.Add("http://127.0.0.1:" + strconv.Itoa(port+i))
+		}
+		counts := make(map[string]int)
+		for i := 0; i < 3000; i++ {
+			counts[r.Get(strconv.Itoa(i))]++
+		}
+		for node, count := range counts {
+			if count < 500 {
+				t.Errorf("TestRingDistribution1 node %s owns %d of 3000 keys", node, count)
+			}
+		}
+		if len(counts) != 3 {
+			t.Errorf("TestRingDistribution2 ring of port %d has keys on %d nodes", port, len(counts))
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package localcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotMagic   = "LCSNAP"
+	snapshotVersion = byte(2) // version 2 saves priority and pinned of keys
+
+	recordEnd   = byte(0)
+	recordEntry = byte(1)
+
+	maxSnapshotFieldLen = 1 << 30 // reject broken length larger than 1GB
+)
+
+// ErrBadSnapshot is returned by Load when the data is not a snapshot
+var ErrBadSnapshot = errors.New("localcache: bad snapshot")
+
+// Save write keys not expired to w, keys are from the coldest to the hottest,
+// values are encoded by the codec set by WithCodec.
+func (l *localCache) Save(w io.Writer) error {
+	if l.isClosed() {
+		return ErrClosed
+	}
+	return l.save(w)
+}
+
+// Load read keys saved by Save and set them to cache with the remaining ttl, priority and pinned,
+// keys are set by order so the hottest key is the front of policy.
+func (l *localCache) Load(r io.Reader) error {
+	if l.isClosed() {
+		return ErrClosed
+	}
+	return readSnapshot(r, l.codec, l.setWithMeta)
+}
+
+// save write snapshot to w, can be called after closed to do the final save
+func (l *localCache) save(w io.Writer) error {
+	return l.savePrefix(w, "")
+}
+
+// savePrefix write keys start with prefix to w without the prefix, tags without the prefix are dropped
+func (l *localCache) savePrefix(w io.Writer, prefix string) error {
+	bw := bufio.NewWriter(w)
+	writeSnapshotHeader(bw)
+	buf := make([]byte, binary.MaxVarintLen64)
+	now := time.Now().Unix()
+	for _, obj := range l.snapshot() {
+		element := l.policy.unpack(obj)
+		// the key may be deleted or set again after snapshot
+		if objNow, has := l.dict.Get(element.key); !has || objNow != obj {
+			continue
+		}
+		element.lock.RLock()
+		value, expireTime, tags := element.value, element.expireTime, element.tags
+		element.lock.RUnlock()
+		// pinned of meta is false if the key is kept as a normal key
+		meta := element.entryMeta
+		key, tags, has := trimPrefix(prefix, element.key, tags)
+		if !has || expireTime < now {
+			continue
+		}
+		data, err := l.snapshotValue(value)
+		if err != nil {
+			return err
+		}
+		writeRecord(bw, buf, key, expireTime, tags, data, meta)
+	}
+	bw.WriteByte(recordEnd)
+	return bw.Flush()
+}
+
+// snapshot return objs in policy from the coldest to the hottest
+func (l *localCache) snapshot() []interface{} {
+	if !l.isClosed() {
+		// wait cacheProcess add the objs in queue to policy
+		done := make(chan struct{})
+		if l.send(opMsg{opType: opTypeSync, done: done}) {
+			<-done
+		}
+	}
+	var objs []interface{}
+	collect := func(obj interface{}) bool {
+		objs = append(objs, obj)
+		return true
+	}
+	if l.shardPolicies != nil {
+		l.keyLock.LockAll()
+		for _, p := range l.shardPolicies {
+			p.walk(collect)
+		}
+		l.keyLock.UnlockAll()
+	}
+	l.policyLock.Lock()
+	if l.shardPolicies == nil {
+		l.policy.walk(collect)
+	}
+	for _, ns := range l.namespaces.list() {
+		if ns.policy != nil {
+			ns.policy.walk(collect)
+		}
+	}
+	l.policyLock.Unlock()
+	return objs
+}
+
+// loadPrefix read keys saved by Save and set them to cache with prefix added to keys and tags
+func (l *localCache) loadPrefix(r io.Reader, prefix string) error {
+	if l.isClosed() {
+		return ErrClosed
+	}
+	return readSnapshot(r, l.codec, addPrefix(prefix, l.setWithMeta))
+}
+
+// trimPrefix return key and tags without prefix, false if key does not start with prefix
+func trimPrefix(prefix, key string, tags []string) (string, []string, bool) {
+	if prefix == "" {
+		return key, tags, true
+	}
+	if !strings.HasPrefix(key, prefix) {
+		return "", nil, false
+	}
+	var trimmed []string
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) {
+			trimmed = append(trimmed, tag[len(prefix):])
+		}
+	}
+	return key[len(prefix):], trimmed, true
+}
+
+// addPrefix return a set func which adds prefix to keys and tags before set
+func addPrefix(prefix string, set func(key string, value interface{}, ttl int64, tags []string, meta entryMeta)) func(key string, value interface{}, ttl int64, tags []string, meta entryMeta) {
+	return func(key string, value interface{}, ttl int64, tags []string, meta entryMeta) {
+		prefixed := make([]string, len(tags))
+		for i, tag := range tags {
+			prefixed[i] = prefix + tag
+		}
+		set(prefix+key, value, ttl, prefixed, meta)
+	}
+}
+
+// persist save snapshot to persistPath
+func (l *localCache) persist() error {
+	return persistFile(l.persistPath, l.save)
+}
+
+// persistFile call save to write snapshot to path, write a temp file and rename so the file is always complete
+func persistFile(path string, save func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err = save(f); err == nil {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// loadPersist load snapshot from persistPath at startup
+func (l *localCache) loadPersist() error {
+	return loadFile(l.persistPath, l.Load)
+}
+
+// loadFile call load to read snapshot from path, a missing file is ok
+func loadFile(path string, load func(r io.Reader) error) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return load(f)
+}
+
+// persistProcess run a loop to save snapshot every persistInterval
+func (l *localCache) persistProcess() {
+	defer l.wg.Done()
+	// the final save is done by Close after cacheProcess exit
+	persistLoop(l.stopChan, l.persistInterval, l.persist, l.onError)
+}
+
+// persistLoop call persist every interval until stop
+func persistLoop(stop <-chan struct{}, interval time.Duration, persist func() error, onError func(err error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if err := persist(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// readSnapshot read records of snapshot, decode values by codec and call set with the remaining ttl,
+// keys of a version 1 snapshot have no priority and are not pinned
+func readSnapshot(r io.Reader, codec Codec, set func(key string, value interface{}, ttl int64, tags []string, meta entryMeta)) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return ErrBadSnapshot
+	}
+	version := header[len(snapshotMagic)]
+	if version < 1 || version > snapshotVersion {
+		return ErrBadSnapshot
+	}
+	now := time.Now().Unix()
+	for {
+		flag, err := br.ReadByte()
+		if err == io.EOF {
+			// no end flag, the snapshot is truncated
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if flag == recordEnd {
+			return nil
+		}
+		if flag != recordEntry {
+			return ErrBadSnapshot
+		}
+		key, err := readString(br)
+		if err != nil {
+			return err
+		}
+		expireTime, err := binary.ReadVarint(br)
+		if err != nil {
+			return err
+		}
+		tagCnt, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		if tagCnt > maxSnapshotFieldLen {
+			return ErrBadSnapshot
+		}
+		var tags []string
+		for i := uint64(0); i < tagCnt; i++ {
+			tag, err := readString(br)
+			if err != nil {
+				return err
+			}
+			tags = append(tags, tag)
+		}
+		data, err := readBytes(br)
+		if err != nil {
+			return err
+		}
+		var meta entryMeta
+		if version >= 2 {
+			if meta, err = readMeta(br); err != nil {
+				return err
+			}
+		}
+		// expired while saved
+		if expireTime < now {
+			continue
+		}
+		value, err := codec.Unmarshal(data)
+		if err != nil {
+			return err
+		}
+		set(key, value, expireTime-now, tags, meta)
+	}
+}
+
+// writeSnapshotHeader write magic and version of snapshot
+func writeSnapshotHeader(w *bufio.Writer) {
+	w.WriteString(snapshotMagic)
+	w.WriteByte(snapshotVersion)
+}
+
+// writeRecord write an entry record of snapshot
+func writeRecord(w *bufio.Writer, buf []byte, key string, expireTime int64, tags []string, data []byte, meta entryMeta) {
+	w.WriteByte(recordEntry)
+	writeString(w, buf, key)
+	w.Write(buf[:binary.PutVarint(buf, expireTime)])
+	w.Write(buf[:binary.PutUvarint(buf, uint64(len(tags)))])
+	for _, tag := range tags {
+		writeString(w, buf, tag)
+	}
+	w.Write(buf[:binary.PutUvarint(buf, uint64(len(data)))])
+	w.Write(data)
+	w.Write(buf[:binary.PutVarint(buf, int64(meta.priority))])
+	if meta.pinned {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+}
+
+// readMeta read priority and pinned of a record
+func readMeta(r *bufio.Reader) (entryMeta, error) {
+	priority, err := binary.ReadVarint(r)
+	if err != nil {
+		return entryMeta{}, err
+	}
+	pinned, err := r.ReadByte()
+	if err != nil {
+		return entryMeta{}, err
+	}
+	return entryMeta{priority: int(priority), pinned: pinned == 1}, nil
+}
+
+func writeString(w *bufio.Writer, buf []byte, s string) {
+	w.Write(buf[:binary.PutUvarint(buf, uint64(len(s)))])
+	w.WriteString(s)
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotFieldLen {
+		return nil, ErrBadSnapshot
+	}
+	data := make([]byte, n)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	data, err := readBytes(r)
+	return string(data), err
+}
+
+// snapshotValue encode value by codec, compressed value is only decompressed because it is encoded by codec already
+func (l *localCache) snapshotValue(value interface{}) ([]byte, error) {
+	if l.compression != nil {
+		return l.compression.Decompress(value.([]byte))
+	}
+	return l.codec.Marshal(value)
+}
@@ -0,0 +1,147 @@
+package localcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	c := NewLocalCache(WithCapacity(4))
+	c.SetWithTags("a", 1, 100, "t")
+	c.Set("b", "2")
+	c.Set("c", []byte("3"))
+	c.SetWithExpire("expired", 4, -1)
+	time.Sleep(10 * time.Millisecond)
+	c.Get("a") // LRU order from cold to hot: b c a
+	time.Sleep(10 * time.Millisecond)
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatalf("TestSaveLoad1 err=%v", err)
+	}
+	c.Stop()
+
+	c = NewLocalCache(WithCapacity(3))
+	defer c.Stop()
+	if err := c.Load(&buf); err != nil {
+		t.Fatalf("TestSaveLoad2 err=%v", err)
+	}
+	if c.Len() != 3 {
+		t.Errorf("TestSaveLoad3 len %d <> 3", c.Len())
+	}
+	if v, _ := c.Get("c"); string(v.([]byte)) != "3" {
+		t.Errorf("TestSaveLoad4 c = %v", v)
+	}
+	if ttl, _ := c.TTL("a"); ttl <= 98*time.Second {
+		t.Errorf("TestSaveLoad5 ttl of a %v", ttl)
+	}
+	// the coldest b is evicted
+	c.Set("d", 4)
+	time.Sleep(10 * time.Millisecond)
+	if _, has := c.Get("b"); has {
+		t.Error("TestSaveLoad6 b exists")
+	}
+	if n := c.InvalidateTag("t"); n != 1 {
+		t.Errorf("TestSaveLoad7 invalidate tag t %d <> 1", n)
+	}
+	if err := c.Load(bytes.NewReader([]byte("bad"))); err != ErrBadSnapshot {
+		t.Errorf("TestSaveLoad8 err=%v", err)
+	}
+}
+
+func TestSaveLoadMeta(t *testing.T) {
+	c := NewLocalCache(WithCapacity(10))
+	c.SetWithOptions("p", 1, Options{Pinned: true})
+	c.SetWithOptions("h", 2, Options{Priority: 1})
+	c.Set("n", 3)
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatalf("TestSaveLoadMeta1 err=%v", err)
+	}
+	c.Stop()
+
+	c = NewLocalCache(WithCapacity(10))
+	defer c.Stop()
+	if err := c.Load(&buf); err != nil {
+		t.Fatalf("TestSaveLoadMeta2 err=%v", err)
+	}
+	l := c.(*localCache)
+	want := map[string]entryMeta{"p": {pinned: true}, "h": {priority: 1}, "n": {}}
+	for key, meta := range want {
+		obj, has := l.dict.Get(key)
+		if !has {
+			t.Fatalf("TestSaveLoadMeta3 %s not loaded", key)
+		}
+		if got := l.policy.unpack(obj).entryMeta; got != meta {
+			t.Errorf("TestSaveLoadMeta4 meta of %s %+v <> %+v", key, got, meta)
+		}
+	}
+	if pinned := c.Stats().PinnedWeight; pinned != 1 {
+		t.Errorf("TestSaveLoadMeta5 pinned weight %d <> 1", pinned)
+	}
+}
+
+func TestLoadVersion1(t *testing.T) {
+	// a snapshot of version 1 has no priority and pinned
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(1)
+	bw.WriteByte(recordEntry)
+	varint := make([]byte, binary.MaxVarintLen64)
+	writeString(bw, varint, "a")
+	bw.Write(varint[:binary.PutVarint(varint, time.Now().Unix()+100)])
+	bw.WriteByte(0) // no tags
+	writeString(bw, varint, "1")
+	bw.WriteByte(recordEnd)
+	bw.Flush()
+	c := NewLocalCache(WithCodec(JSONCodec))
+	defer c.Stop()
+	if err := c.Load(&buf); err != nil {
+		t.Fatalf("TestLoadVersion1 err=%v", err)
+	}
+	if v, has := c.Get("a"); !has || v != float64(1) {
+		t.Errorf("TestLoadVersion1 a = %v", v)
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	c := NewLocalCache(WithCodec(JSONCodec))
+	defer c.Stop()
+	c.Set("a", map[string]interface{}{"id": 1})
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatalf("TestJSONCodec1 err=%v", err)
+	}
+	c.Del("a")
+	if err := c.Load(&buf); err != nil {
+		t.Fatalf("TestJSONCodec2 err=%v", err)
+	}
+	if v, _ := c.Get("a"); v.(map[string]interface{})["id"].(float64) != 1 {
+		t.Errorf("TestJSONCodec3 a = %v", v)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	c := NewLocalCache(WithPersistence(path, 10*time.Millisecond))
+	c.Set("a", 1)
+	time.Sleep(50 * time.Millisecond)
+	// saved by interval
+	c2 := NewLocalCache(WithPersistence(path, 0))
+	if _, has := c2.Get("a"); !has {
+		t.Error("TestPersistence1 a not exists")
+	}
+	c2.Stop()
+	// saved when close
+	c.Set("b", 2)
+	c.Stop()
+	c2 = NewLocalCache(WithPersistence(path, 0))
+	defer c2.Stop()
+	if _, has := c2.Get("b"); !has {
+		t.Error("TestPersistence2 b not exists")
+	}
+}
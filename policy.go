@@ -19,16 +19,24 @@ type policy interface {
 	unpack(interface{}) *element
 	// pack element to interface
 	pack(*element) interface{}
+	// walk call f from the coldest to the hottest obj, stop when f return false
+	walk(f func(obj interface{}) bool)
+	// evictOne evict the coldest obj which can be evicted, return false if none
+	evictOne() bool
+	// fit evict objs until weight is not over capacity, objs can not be evicted are kept
+	fit()
 }
 
-// newPolicy return policy implement by type const
-func newPolicy(policyType string, cap int, cache *localCache) policy {
+// newPolicy return policy implement by type const,
+// evict is called after policy removed an obj to free space,
+// canEvict return whether an obj can be evicted, nil means all objs can.
+func newPolicy(policyType string, cap int, evict func(obj interface{}), canEvict func(obj interface{}) bool) policy {
 	var p policy
 	switch policyType {
 	case PolicyTypeLRU:
-		p = newPolicyLRU(cap, cache)
+		p = newPolicyLRU(cap, evict, canEvict)
 	default:
-		p = newPolicyLRU(cap, cache)
+		p = newPolicyLRU(cap, evict, canEvict)
 	}
 	return p
 }
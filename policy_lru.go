@@ -1,21 +1,34 @@
 package localcache
 
 import (
+	"sort"
+
 	"github.com/MoeYang/go-localcache/datastruct/list"
 )
 
 type policyLRU struct {
-	cap   int
-	cache *localCache // the cache obj
-	list  *list.List
+	cap    int64
+	weight int64                 // total weight of elements in lists
+	evict  func(obj interface{}) // del the evicted obj from cache
+	// canEvict return whether obj can be evicted, nil means all objs can
+	canEvict func(obj interface{}) bool
+	// list of elements of priority 0, most elements are in it
+	list *list.List
+	// lists of every priority, sorted by priorities from low to high
+	lists      map[int]*list.List
+	priorities []int
+	// pinned elements are never evicted
+	pinned *list.List
 }
 
-func newPolicyLRU(cap int, cache *localCache) policy {
-	return &policyLRU{
-		cap:   cap,
-		cache: cache,
-		list:  list.New(),
+func newPolicyLRU(cap int, evict func(obj interface{}), canEvict func(obj interface{}) bool) policy {
+	p := &policyLRU{
+		cap:      int64(cap),
+		evict:    evict,
+		canEvict: canEvict,
 	}
+	p.flush()
+	return p
 }
 
 func (p *policyLRU) add(obj interface{}) {
@@ -23,16 +36,64 @@ func (p *policyLRU) add(obj interface{}) {
 	if !ok {
 		return
 	}
-	// need to del when list is full
-	if p.list.Len() >= p.cap {
-		lastEle := p.list.Back()
-		if lastEle != nil {
-			// del from cache
-			p.cache.del(lastEle.Value.(*element).key)
-		}
+	l := p.listOf(ele)
+	if l.Contains(ele) {
+		return
+	}
+	weight := ele.Value.(*element).weight
+	// need to del when lists are full, if no obj can be evicted the lists are over capacity
+	for p.weight+weight > p.cap && p.evictOne() {
 	}
 	// push ele to first of list
-	p.list.PushElementFront(ele)
+	l.PushElementFront(ele)
+	p.weight += weight
+}
+
+func (p *policyLRU) evictOne() bool {
+	victim := p.victim()
+	if victim == nil {
+		return false
+	}
+	// del from list and cache
+	p.listOf(victim).Remove(victim)
+	p.weight -= victim.Value.(*element).weight
+	p.evict(victim)
+	return true
+}
+
+func (p *policyLRU) fit() {
+	for p.weight > p.cap && p.evictOne() {
+	}
+}
+
+// victim return the coldest obj of the lowest priority which can be evicted, nil if none
+func (p *policyLRU) victim() *list.Element {
+	for _, priority := range p.priorities {
+		for ele := p.lists[priority].Back(); ele != nil; ele = ele.Prev() {
+			if p.canEvict == nil || p.canEvict(ele) {
+				return ele
+			}
+		}
+	}
+	return nil
+}
+
+// listOf return the list which ele belongs to by its priority, priority and pinned of element never change
+func (p *policyLRU) listOf(ele *list.Element) *list.List {
+	e := ele.Value.(*element)
+	if e.pinned {
+		return p.pinned
+	}
+	if l, has := p.lists[e.priority]; has {
+		return l
+	}
+	l := list.New()
+	p.lists[e.priority] = l
+	i := sort.SearchInts(p.priorities, e.priority)
+	p.priorities = append(p.priorities, 0)
+	copy(p.priorities[i+1:], p.priorities[i:])
+	p.priorities[i] = e.priority
+	return l
 }
 
 func (p *policyLRU) hit(obj interface{}) {
@@ -40,7 +101,7 @@ func (p *policyLRU) hit(obj interface{}) {
 	if !ok {
 		return
 	}
-	p.list.MoveToFront(ele)
+	p.listOf(ele).MoveToFront(ele)
 }
 
 func (p *policyLRU) del(obj interface{}) {
@@ -48,11 +109,18 @@ func (p *policyLRU) del(obj interface{}) {
 	if !ok {
 		return
 	}
-	p.list.Remove(ele)
+	if l := p.listOf(ele); l.Contains(ele) {
+		l.Remove(ele)
+		p.weight -= ele.Value.(*element).weight
+	}
 }
 
 func (p *policyLRU) flush() {
 	p.list = list.New()
+	p.lists = map[int]*list.List{0: p.list}
+	p.priorities = []int{0}
+	p.pinned = list.New()
+	p.weight = 0
 }
 
 // unpack decode a *list.Element and return *element
@@ -67,3 +135,18 @@ func (p *policyLRU) unpack(obj interface{}) *element {
 func (p *policyLRU) pack(ele *element) interface{} {
 	return p.list.NewElement(ele)
 }
+
+// walk call f for elements of lists from the lowest priority to the highest, pinned elements are the last
+func (p *policyLRU) walk(f func(obj interface{}) bool) {
+	lists := make([]*list.List, 0, len(p.priorities)+1)
+	for _, priority := range p.priorities {
+		lists = append(lists, p.lists[priority])
+	}
+	for _, l := range append(lists, p.pinned) {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			if !f(ele) {
+				return
+			}
+		}
+	}
+}
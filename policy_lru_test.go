@@ -1,6 +1,8 @@
 package localcache
 
 import (
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -50,3 +52,96 @@ func TestHit(t *testing.T) {
 		t.Errorf("TestHit list front <> 2, %+v", policy.list.Front().Value)
 	}
 }
+
+func TestShardedPolicy(t *testing.T) {
+	c := NewLocalCache(WithCapacity(8), WithShardCount(4), WithShardedPolicy(true))
+	defer c.Stop()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := strconv.Itoa(i*100 + j)
+				c.Set(key, j)
+				c.Get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// every shard keep 2 keys, no wait because policy is updated inline
+	if c.Len() != 8 {
+		t.Errorf("TestShardedPolicy1 len %d <> 8", c.Len())
+	}
+	l := c.(*localCache)
+	for i, p := range l.shardPolicies {
+		if n := p.(*policyLRU).list.Len(); n != 2 {
+			t.Errorf("TestShardedPolicy2 shard %d list len %d <> 2", i, n)
+		}
+	}
+	// the last key set must be in cache
+	c.Set("new", 1)
+	if _, has := c.Get("new"); !has {
+		t.Error("TestShardedPolicy3 new not exists")
+	}
+	c.Del("new")
+	if n := l.shardPolicy("new").(*policyLRU).list.Len(); n != 1 {
+		t.Errorf("TestShardedPolicy4 list len %d <> 1 after del", n)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	c := NewLocalCache(WithCapacity(3))
+	defer c.Stop()
+	c.SetWithOptions("high", 1, Options{Priority: 1})
+	c.Set("a", 1)
+	c.Set("b", 1)
+	c.Set("c", 1)
+	c.Set("d", 1)
+	// wait cacheProcess apply the adds
+	c.(*localCache).snapshot()
+	if _, has := c.Get("high"); !has {
+		t.Error("TestPriority1 high priority key evicted")
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, has := c.Get(key); has {
+			t.Errorf("TestPriority2 low priority key %s not evicted", key)
+		}
+	}
+}
+
+func TestPinned(t *testing.T) {
+	c := NewLocalCache(WithCapacity(4), WithMaxPinnedWeight(2))
+	defer c.Stop()
+	for _, key := range []string{"p1", "p2", "p3"} {
+		c.SetWithOptions(key, 1, Options{Pinned: true, TTL: 60})
+	}
+	if w := c.Stats().PinnedWeight; w != 2 {
+		t.Errorf("TestPinned1 pinned weight %d", w)
+	}
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.(*localCache).snapshot()
+	if _, has := c.Get("p3"); has {
+		t.Error("TestPinned2 p3 over max pinned weight is not evicted")
+	}
+	for _, key := range []string{"p1", "p2"} {
+		if _, has := c.Get(key); !has {
+			t.Errorf("TestPinned3 pinned key %s evicted", key)
+		}
+	}
+	if c.Len() != 4 {
+		t.Errorf("TestPinned4 len %d", c.Len())
+	}
+
+	// cas keeps the key pinned, set without options unpin it
+	_, version, _ := c.GetWithVersion("p2")
+	if !c.CompareAndSwap("p2", 2, 60, version) || c.Stats().PinnedWeight != 2 {
+		t.Errorf("TestPinned5 cas pinned weight %d", c.Stats().PinnedWeight)
+	}
+	c.Set("p1", 2)
+	if w := c.Stats().PinnedWeight; w != 1 {
+		t.Errorf("TestPinned6 pinned weight after set %d", w)
+	}
+}
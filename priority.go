@@ -0,0 +1,92 @@
+package localcache
+
+import "sync/atomic"
+
+// Options of a key set by SetWithOptions
+type Options struct {
+	// TTL is seconds to live, 0 means the global ttl
+	TTL int64
+	// Priority of key, keys of lower priority are evicted first, default 0
+	Priority int
+	// Pinned key is never evicted but still expires by ttl.
+	// It is kept as a normal key if the weight of pinned keys will be over WithMaxPinnedWeight.
+	Pinned bool
+}
+
+// entryMeta is how a key is evicted
+type entryMeta struct {
+	priority int
+	pinned   bool
+}
+
+// WithMaxPinnedWeight set the max total weight of pinned keys, default half of capacity,
+// so there is always space for keys not pinned.
+func WithMaxPinnedWeight(weight int64) Option {
+	return func(c *localCache) {
+		c.maxPinnedWeight = weight
+	}
+}
+
+// SetWithOptions set a key-value with ttl, priority and whether it is pinned, write it to backing store if need.
+// A set without options makes the key normal again.
+func (l *localCache) SetWithOptions(key string, value interface{}, opts Options) {
+	if l.isClosed() {
+		return
+	}
+	if l.store != nil && !l.writeStore(key, value) {
+		return
+	}
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = l.ttl
+	}
+	l.setWithMeta(key, value, ttl, nil, entryMeta{priority: opts.Priority, pinned: opts.Pinned})
+}
+
+// pin add weight to pinned keys of cache and ns, return false if it will be over maxPinnedWeight of cache,
+// or of ns if ns has quota. ns may be nil.
+func (l *localCache) pin(ns *namespace, weight int64) bool {
+	if !addPinned(&l.pinnedWeight, l.maxPinnedWeight, weight) {
+		return false
+	}
+	if ns == nil {
+		return true
+	}
+	if ns.policy == nil {
+		atomic.AddInt64(&ns.pinnedWeight, weight)
+		return true
+	}
+	if !addPinned(&ns.pinnedWeight, ns.maxPinnedWeight, weight) {
+		atomic.AddInt64(&l.pinnedWeight, -weight)
+		return false
+	}
+	return true
+}
+
+// addPinned add weight to *pinned, return false if it will be over max
+func addPinned(pinned *int64, max, weight int64) bool {
+	for {
+		old := atomic.LoadInt64(pinned)
+		if old+weight > max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(pinned, old, old+weight) {
+			return true
+		}
+	}
+}
+
+// SetWithOptions set a key-value with ttl.
+// Arena cache ignores priority and pinned, the oldest keys are always overwritten first.
+func (c *arenaCache) SetWithOptions(key string, value interface{}, opts Options) {
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	c.SetWithTags(key, value, ttl)
+}
+
+func (v *namespaceView) SetWithOptions(key string, value interface{}, opts Options) {
+	v.ns.statist.setIncr()
+	v.cache.SetWithOptions(v.key(key), value, opts)
+}
@@ -0,0 +1,141 @@
+// Package prometheus export statistic of localcache to prometheus.
+//
+//	collector := prometheus.NewCollector("localcache")
+//	collector.Add("users", usersCache)
+//	registry.MustRegister(collector)
+package prometheus
+
+import (
+	"sync"
+
+	"github.com/MoeYang/go-localcache"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultNamespace = "localcache"
+
+// Collector implement prometheus.Collector for one or more named caches,
+// every metric has a label "cache" with the name of cache.
+type Collector struct {
+	lock   sync.RWMutex
+	caches map[string]localcache.Cache
+
+	hits         *prom.Desc
+	misses       *prom.Desc
+	sets         *prom.Desc
+	deletes      *prom.Desc
+	evictions    *prom.Desc
+	expirations  *prom.Desc
+	loads        *prom.Desc
+	loadDuration *prom.Desc
+	sharedLoads  *prom.Desc
+	droppedHits  *prom.Desc
+	backpressure *prom.Desc
+	entries      *prom.Desc
+	weight       *prom.Desc
+	queueDepth   *prom.Desc
+	diskHits     *prom.Desc
+	diskEntries  *prom.Desc
+	diskBytes    *prom.Desc
+}
+
+// NewCollector return a Collector, namespace is the prefix of metric names, default "localcache"
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	desc := func(name, help string, labels ...string) *prom.Desc {
+		return prom.NewDesc(prom.BuildFQName(namespace, "", name), help, append([]string{"cache"}, labels...), nil)
+	}
+	return &Collector{
+		caches:       make(map[string]localcache.Cache),
+		hits:         desc("hits_total", "Count of gets which hit."),
+		misses:       desc("misses_total", "Count of gets which miss."),
+		sets:         desc("sets_total", "Count of sets."),
+		deletes:      desc("deletes_total", "Count of keys deleted by user."),
+		evictions:    desc("evictions_total", "Count of keys evicted to free space.", "cause"),
+		expirations:  desc("expirations_total", "Count of keys deleted because expired."),
+		loads:        desc("loads_total", "Count of loads by GetOrLoad.", "result"),
+		loadDuration: desc("load_duration_seconds", "Histogram of load time."),
+		sharedLoads:  desc("shared_loads_total", "Count of loads which share result of another in-flight load."),
+		droppedHits:  desc("dropped_hits_total", "Count of hits dropped by read buffer."),
+		backpressure: desc("backpressure_total", "Count of writes which find the write buffer full."),
+		entries:      desc("entries", "Count of keys in cache."),
+		weight:       desc("weight", "Total weight of keys in cache."),
+		queueDepth:   desc("queue_depth", "Count of ops waiting in the write buffer."),
+		diskHits:     desc("disk_hits_total", "Count of hits promoted from disk tier."),
+		diskEntries:  desc("disk_entries", "Count of keys in disk tier."),
+		diskBytes:    desc("disk_bytes", "Bytes of files of disk tier."),
+	}
+}
+
+// Add a cache to collect with name, replace the cache with same name
+func (c *Collector) Add(name string, cache localcache.Cache) {
+	c.lock.Lock()
+	c.caches[name] = cache
+	c.lock.Unlock()
+}
+
+// Remove the cache of name
+func (c *Collector) Remove(name string) {
+	c.lock.Lock()
+	delete(c.caches, name)
+	c.lock.Unlock()
+}
+
+// Describe implement prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	for _, desc := range []*prom.Desc{
+		c.hits, c.misses, c.sets, c.deletes, c.evictions, c.expirations, c.loads, c.loadDuration,
+		c.sharedLoads, c.droppedHits, c.backpressure, c.entries, c.weight, c.queueDepth,
+		c.diskHits, c.diskEntries, c.diskBytes,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implement prometheus.Collector
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for name, cache := range c.caches {
+		c.collect(ch, name, cache.Stats())
+	}
+}
+
+func (c *Collector) collect(ch chan<- prom.Metric, name string, stats localcache.Stats) {
+	counter := func(desc *prom.Desc, v uint64, labels ...string) {
+		ch <- prom.MustNewConstMetric(desc, prom.CounterValue, float64(v), append([]string{name}, labels...)...)
+	}
+	gauge := func(desc *prom.Desc, v float64) {
+		ch <- prom.MustNewConstMetric(desc, prom.GaugeValue, v, name)
+	}
+	counter(c.hits, stats.Hits)
+	counter(c.misses, stats.Misses)
+	counter(c.sets, stats.Sets)
+	counter(c.deletes, stats.Deletes)
+	counter(c.evictions, stats.Evictions.Capacity, "capacity")
+	counter(c.evictions, stats.Evictions.WriteBuffer, "write_buffer")
+	counter(c.expirations, stats.Expirations)
+	counter(c.loads, stats.LoadSuccesses, "success")
+	counter(c.loads, stats.LoadFailures, "failure")
+	counter(c.sharedLoads, stats.SharedLoads)
+	counter(c.droppedHits, stats.DroppedHits)
+	counter(c.backpressure, stats.Backpressure)
+	gauge(c.entries, float64(stats.Entries))
+	gauge(c.weight, float64(stats.Weight))
+	gauge(c.queueDepth, float64(stats.QueueDepth))
+	counter(c.diskHits, stats.DiskHits)
+	gauge(c.diskEntries, float64(stats.DiskEntries))
+	gauge(c.diskBytes, float64(stats.DiskBytes))
+
+	// prometheus histogram buckets are cumulative
+	buckets := make(map[float64]uint64, len(localcache.LoadLatencyBuckets))
+	var count uint64
+	for i, bound := range localcache.LoadLatencyBuckets {
+		count += stats.LoadLatency[i]
+		buckets[bound.Seconds()] = count
+	}
+	count += stats.LoadLatency[len(localcache.LoadLatencyBuckets)]
+	ch <- prom.MustNewConstHistogram(c.loadDuration, count, stats.TotalLoadTime.Seconds(), buckets, name)
+}
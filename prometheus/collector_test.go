@@ -0,0 +1,53 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MoeYang/go-localcache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	users := localcache.NewLocalCache(localcache.WithStatist(true))
+	defer users.Stop()
+	orders := localcache.NewLocalCache(localcache.WithStatist(true))
+	defer orders.Stop()
+	users.Set("1", 1)
+	users.Get("1")
+	users.Get("2")
+	orders.Get("1")
+	orders.GetOrLoad("1", func() (interface{}, error) { return 1, nil })
+
+	c := NewCollector("")
+	c.Add("users", users)
+	c.Add("orders", orders)
+	expected := `
+# HELP localcache_hits_total Count of gets which hit.
+# TYPE localcache_hits_total counter
+localcache_hits_total{cache="orders"} 0
+localcache_hits_total{cache="users"} 1
+# HELP localcache_misses_total Count of gets which miss.
+# TYPE localcache_misses_total counter
+localcache_misses_total{cache="orders"} 2
+localcache_misses_total{cache="users"} 1
+# HELP localcache_entries Count of keys in cache.
+# TYPE localcache_entries gauge
+localcache_entries{cache="orders"} 1
+localcache_entries{cache="users"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"localcache_hits_total", "localcache_misses_total", "localcache_entries"); err != nil {
+		t.Errorf("TestCollector1 %v", err)
+	}
+	if n := testutil.CollectAndCount(c, "localcache_load_duration_seconds"); n != 2 {
+		t.Errorf("TestCollector2 load histogram count %d <> 2", n)
+	}
+	if problems, err := testutil.CollectAndLint(c); err != nil || len(problems) != 0 {
+		t.Errorf("TestCollector3 lint %v %v", problems, err)
+	}
+	c.Remove("orders")
+	if n := testutil.CollectAndCount(c, "localcache_hits_total"); n != 1 {
+		t.Errorf("TestCollector4 hits count %d <> 1", n)
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/MoeYang/go-localcache/prometheus
+
+go 1.15
+
+require (
+	github.com/MoeYang/go-localcache v0.0.0-00010101000000-000000000000
+	github.com/prometheus/client_golang v1.11.1
+)
+
+// the collector uses the Stats API of the core in this repo, which is not in a tagged version yet
+replace github.com/MoeYang/go-localcache => ../
@@ -0,0 +1,123 @@
+package localcache
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	readStripeSize     = 32 // max hits a stripe can hold before drained
+	readStripeAttempts = 4  // max stripes tried by a push
+)
+
+// probeSeed is the seed of new probes, probePool keeps a probe for every P mostly,
+// because sync.Pool caches objects per P. Go does not expose the P id, so this is how a stripe is chosen per P.
+var (
+	probeSeed uint32
+	probePool = sync.Pool{New: func() interface{} {
+		probe := atomic.AddUint32(&probeSeed, 0x9e3779b9) | 1 // xorshift never leaves 0
+		return &probe
+	}}
+)
+
+// readBuffer is a striped lossy buffer to record hits, like Caffeine and Ristretto.
+// A stripe is chosen by the probe of P, not by key, so hits of a hot key from many cores spread over stripes.
+// There are at least 4*GOMAXPROCS stripes, a push moves its probe to another stripe when the stripe is busy or full.
+// A hit is dropped when all stripes tried are busy or full, losing some hits is ok for policy.
+type readBuffer struct {
+	stripes   []*readStripe
+	stripeCnt uint32
+	signal    chan struct{} // tell cacheProcess there are hits to drain
+	batch     []interface{} // reused by drain, only cacheProcess use it
+}
+
+type readStripe struct {
+	busy    int32  // 1 while someone use the stripe
+	dropped uint64 // count of hits dropped
+	len     int
+	buf     [readStripeSize]interface{}
+}
+
+func newReadBuffer() *readBuffer {
+	stripeCnt := 1
+	for stripeCnt < 4*runtime.GOMAXPROCS(0) {
+		stripeCnt <<= 1
+	}
+	r := &readBuffer{
+		stripes:   make([]*readStripe, stripeCnt),
+		stripeCnt: uint32(stripeCnt),
+		signal:    make(chan struct{}, 1),
+	}
+	for i := range r.stripes {
+		r.stripes[i] = &readStripe{}
+	}
+	return r
+}
+
+// push record a hit of obj, never block
+func (r *readBuffer) push(obj interface{}) {
+	probe := probePool.Get().(*uint32)
+	defer probePool.Put(probe)
+	var s *readStripe
+	for i := 0; i < readStripeAttempts; i++ {
+		s = r.stripes[*probe&(r.stripeCnt-1)]
+		if s.push(obj) {
+			// signal cacheProcess to drain, skip if signaled already
+			select {
+			case r.signal <- struct{}{}:
+			default:
+			}
+			return
+		}
+		// the stripe is contended or full, rehash the probe by xorshift so this P uses another stripe
+		*probe ^= *probe << 13
+		*probe ^= *probe >> 17
+		*probe ^= *probe << 5
+	}
+	atomic.AddUint64(&s.dropped, 1)
+}
+
+// push add obj to stripe, return false if the stripe is busy or full
+func (s *readStripe) push(obj interface{}) bool {
+	if !atomic.CompareAndSwapInt32(&s.busy, 0, 1) {
+		return false
+	}
+	full := s.len >= readStripeSize
+	if !full {
+		s.buf[s.len] = obj
+		s.len++
+	}
+	atomic.StoreInt32(&s.busy, 0)
+	return !full
+}
+
+// drain take all hits in stripes and call f for each, only called by cacheProcess
+func (r *readBuffer) drain(f func(obj interface{})) {
+	r.batch = r.batch[:0]
+	for _, s := range r.stripes {
+		// pushers hold the stripe very short, so spin to wait
+		for !atomic.CompareAndSwapInt32(&s.busy, 0, 1) {
+			runtime.Gosched()
+		}
+		r.batch = append(r.batch, s.buf[:s.len]...)
+		for i := 0; i < s.len; i++ {
+			s.buf[i] = nil // avoid memory leaks
+		}
+		s.len = 0
+		atomic.StoreInt32(&s.busy, 0)
+	}
+	for i, obj := range r.batch {
+		f(obj)
+		r.batch[i] = nil
+	}
+}
+
+// droppedCount return count of hits dropped
+func (r *readBuffer) droppedCount() uint64 {
+	var count uint64
+	for _, s := range r.stripes {
+		count += atomic.LoadUint64(&s.dropped)
+	}
+	return count
+}
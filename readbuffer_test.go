@@ -0,0 +1,63 @@
+package localcache
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestReadBuffer(t *testing.T) {
+	r := newReadBuffer()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				r.push(j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	var drained uint64
+	r.drain(func(obj interface{}) {
+		drained++
+	})
+	if total := drained + r.droppedCount(); total != 8000 {
+		t.Errorf("TestReadBuffer1 drained %d + dropped %d <> 8000", drained, r.droppedCount())
+	}
+	drained = 0
+	r.drain(func(obj interface{}) {
+		drained++
+	})
+	if drained != 0 {
+		t.Errorf("TestReadBuffer2 drained %d <> 0", drained)
+	}
+}
+
+func TestReadBufferHotKey(t *testing.T) {
+	r := newReadBuffer()
+	var wg sync.WaitGroup
+	// all goroutines hit one key
+	obj := &element{key: "hot"}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.push(obj)
+			}
+		}()
+	}
+	wg.Wait()
+	var drained uint64
+	r.drain(func(obj interface{}) {
+		drained++
+	})
+	if total := drained + r.droppedCount(); total != 1600 {
+		t.Errorf("TestReadBufferHotKey1 drained %d + dropped %d <> 1600", drained, r.droppedCount())
+	}
+	// hits of one key are not limited to one stripe
+	if drained <= readStripeSize {
+		t.Errorf("TestReadBufferHotKey2 drained %d, hits of hot key are in one stripe", drained)
+	}
+}
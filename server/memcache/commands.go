@@ -0,0 +1,455 @@
+package memcache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxKeyLen    = 250
+	maxLineSize  = 8 << 10
+	maxValueSize = 1 << 20
+	// exptime larger than 30 days is a unix timestamp
+	maxRelativeExptime = 60 * 60 * 24 * 30
+	// exptime 0 never expires, the cache has no key without ttl so it lives 100 years
+	neverExpireTTL = 60 * 60 * 24 * 365 * 100
+
+	version = "1.6.0-localcache"
+)
+
+const (
+	replyStored    = "STORED\r\n"
+	replyNotStored = "NOT_STORED\r\n"
+	replyExists    = "EXISTS\r\n"
+	replyNotFound  = "NOT_FOUND\r\n"
+	replyDeleted   = "DELETED\r\n"
+	replyTouched   = "TOUCHED\r\n"
+	replyEnd       = "END\r\n"
+	replyOK        = "OK\r\n"
+	replyError     = "ERROR\r\n"
+
+	errBadFormat  = "CLIENT_ERROR bad command line format\r\n"
+	errBadChunk   = "CLIENT_ERROR bad data chunk\r\n"
+	errTooLarge   = "SERVER_ERROR object too large for cache\r\n"
+	errNonNumeric = "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+	errInvalidNum = "CLIENT_ERROR invalid numeric delta argument\r\n"
+)
+
+var errLineSize = errors.New("line too long")
+
+// readLine read a line without \r\n
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > maxLineSize {
+			return "", errLineSize
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// exec run a command line and write its reply, return true if the client quit,
+// err is not nil if the data block of a storage command can not be read
+func (s *Server) exec(r *bufio.Reader, w *bufio.Writer, line string) (quit bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		w.WriteString(replyError)
+		return false, nil
+	}
+	switch name := fields[0]; name {
+	case "get", "gets":
+		s.get(w, fields[1:], name == "gets")
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return false, s.store(r, w, name, fields[1:])
+	case "delete":
+		s.delete(w, fields[1:])
+	case "incr", "decr":
+		s.incr(w, fields[1:], name == "decr")
+	case "touch":
+		s.touch(w, fields[1:])
+	case "stats":
+		s.stats(w, fields[1:])
+	case "flush_all":
+		s.flushAll(w, fields[1:])
+	case "version":
+		w.WriteString("VERSION " + version + "\r\n")
+	case "quit":
+		return true, nil
+	default:
+		w.WriteString(replyError)
+	}
+	return false, nil
+}
+
+// get <key>*, gets return cas unique of keys too
+func (s *Server) get(w *bufio.Writer, keys []string, withCas bool) {
+	if len(keys) == 0 {
+		w.WriteString(replyError)
+		return
+	}
+	for _, key := range keys {
+		if !validKey(key) {
+			w.WriteString(errBadFormat)
+			return
+		}
+	}
+	for _, key := range keys {
+		value, cas, has := s.cache.GetWithVersion(key)
+		if !has {
+			continue
+		}
+		flags, data := decodeItem(value)
+		if withCas {
+			fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, flags, len(data), cas)
+		} else {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, flags, len(data))
+		}
+		w.Write(data)
+		w.WriteString("\r\n")
+	}
+	w.WriteString(replyEnd)
+}
+
+// store <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]\r\n<data>\r\n
+func (s *Server) store(r *bufio.Reader, w *bufio.Writer, name string, args []string) error {
+	argc := 4
+	if name == "cas" {
+		argc = 5
+	}
+	if len(args) < argc || len(args) > argc+1 {
+		w.WriteString(replyError)
+		return nil
+	}
+	key := args[0]
+	flags, errFlags := strconv.ParseUint(args[1], 10, 32)
+	exptime, errExptime := strconv.ParseInt(args[2], 10, 64)
+	size, errSize := strconv.Atoi(args[3])
+	var cas uint64
+	var errCas error
+	if name == "cas" {
+		cas, errCas = strconv.ParseUint(args[4], 10, 64)
+	}
+	noreply := len(args) == argc+1 && args[argc] == "noreply"
+	if errSize != nil || size < 0 {
+		w.WriteString(errBadFormat)
+		// the length of data block is unknown, close the connection
+		return errors.New("bad data length")
+	}
+	if size > maxValueSize {
+		w.WriteString(errTooLarge)
+		// skip the data block
+		_, err := io.CopyN(ioutil.Discard, r, int64(size)+2)
+		return err
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		w.WriteString(errBadChunk)
+		return errors.New("bad data chunk")
+	}
+	data = data[:size]
+	if !validKey(key) || errFlags != nil || errExptime != nil || errCas != nil {
+		w.WriteString(errBadFormat)
+		return nil
+	}
+	reply := s.storeItem(name, key, uint32(flags), exptime, data, cas)
+	if !noreply {
+		w.WriteString(reply)
+	}
+	return nil
+}
+
+// storeItem run a storage command under keyLock and return the reply
+func (s *Server) storeItem(name, key string, flags uint32, exptime int64, data []byte, cas uint64) string {
+	s.keyLock.Lock(key)
+	defer s.keyLock.Unlock(key)
+	ttl, expired := toTTL(exptime)
+	switch name {
+	case "set":
+		if expired {
+			s.cache.Del(key)
+		} else if !s.set(key, encodeItem(flags, data), ttl) {
+			return replyNotStored
+		}
+		return replyStored
+	case "cas":
+		if _, has := s.cache.TTL(key); !has {
+			return replyNotFound
+		}
+		if expired {
+			// an expired item is deleted, swap first to check the version
+			if !s.cache.CompareAndSwap(key, encodeItem(flags, data), 1, cas) {
+				return replyExists
+			}
+			s.cache.Del(key)
+			return replyStored
+		}
+		if !s.cache.CompareAndSwap(key, encodeItem(flags, data), ttl, cas) {
+			return replyExists
+		}
+		return replyStored
+	}
+	value, has := s.cache.Get(key)
+	switch name {
+	case "add":
+		if has {
+			return replyNotStored
+		}
+	case "replace":
+		if !has {
+			return replyNotStored
+		}
+	case "append", "prepend":
+		if !has {
+			return replyNotStored
+		}
+		// flags and exptime are ignored, the item keeps them
+		oldFlags, old := decodeItem(value)
+		if name == "append" {
+			data = append(append([]byte(nil), old...), data...)
+		} else {
+			data = append(data, old...)
+		}
+		if !s.set(key, encodeItem(oldFlags, data), s.remainingTTL(key)) {
+			return replyNotStored
+		}
+		return replyStored
+	}
+	if expired {
+		s.cache.Del(key)
+	} else if !s.set(key, encodeItem(flags, data), ttl) {
+		return replyNotStored
+	}
+	return replyStored
+}
+
+// delete <key> [noreply]
+func (s *Server) delete(w *bufio.Writer, args []string) {
+	if len(args) < 1 || len(args) > 2 || !validKey(args[0]) {
+		w.WriteString(errBadFormat)
+		return
+	}
+	reply := replyNotFound
+	if s.cache.Del(args[0]) {
+		reply = replyDeleted
+	}
+	if len(args) == 1 {
+		w.WriteString(reply)
+	}
+}
+
+// incr|decr <key> <value> [noreply], incr wraps at 64 bits, decr stops at 0
+func (s *Server) incr(w *bufio.Writer, args []string, decr bool) {
+	if len(args) < 2 || len(args) > 3 || !validKey(args[0]) {
+		w.WriteString(errBadFormat)
+		return
+	}
+	key := args[0]
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		w.WriteString(errInvalidNum)
+		return
+	}
+	noreply := len(args) == 3
+	s.keyLock.Lock(key)
+	defer s.keyLock.Unlock(key)
+	value, has := s.cache.Get(key)
+	if !has {
+		if !noreply {
+			w.WriteString(replyNotFound)
+		}
+		return
+	}
+	flags, data := decodeItem(value)
+	n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		w.WriteString(errNonNumeric)
+		return
+	}
+	if !decr {
+		n += delta
+	} else if delta > n {
+		n = 0
+	} else {
+		n -= delta
+	}
+	result := strconv.FormatUint(n, 10)
+	s.set(key, encodeItem(flags, []byte(result)), s.remainingTTL(key))
+	if !noreply {
+		w.WriteString(result + "\r\n")
+	}
+}
+
+// touch <key> <exptime> [noreply]
+func (s *Server) touch(w *bufio.Writer, args []string) {
+	if len(args) < 2 || len(args) > 3 || !validKey(args[0]) {
+		w.WriteString(errBadFormat)
+		return
+	}
+	key := args[0]
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		w.WriteString(errBadFormat)
+		return
+	}
+	var has bool
+	switch ttl, expired := toTTL(exptime); {
+	case expired:
+		has = s.cache.Del(key)
+	default:
+		// only the ttl changes, the cas unique is kept
+		has = s.cache.Touch(key, ttl)
+	}
+	if len(args) == 3 {
+		return
+	}
+	if has {
+		w.WriteString(replyTouched)
+	} else {
+		w.WriteString(replyNotFound)
+	}
+}
+
+// stats write general stats, stats of sub commands like "stats items" are empty
+func (s *Server) stats(w *bufio.Writer, args []string) {
+	if len(args) > 0 {
+		w.WriteString(replyEnd)
+		return
+	}
+	now := time.Now()
+	stats := s.cache.Stats()
+	writeStat := func(name string, value interface{}) {
+		fmt.Fprintf(w, "STAT %s %v\r\n", name, value)
+	}
+	writeStat("pid", os.Getpid())
+	writeStat("uptime", int64(now.Sub(s.started)/time.Second))
+	writeStat("time", now.Unix())
+	writeStat("version", version)
+	writeStat("curr_items", s.cache.Len())
+	writeStat("cmd_get", stats.Hits+stats.Misses)
+	writeStat("cmd_set", stats.Sets)
+	writeStat("get_hits", stats.Hits)
+	writeStat("get_misses", stats.Misses)
+	writeStat("delete_hits", stats.Deletes)
+	writeStat("evictions", stats.Evictions.Total())
+	writeStat("expired_unfetched", stats.Expirations)
+	w.WriteString(replyEnd)
+}
+
+// flush_all [delay] [noreply]
+func (s *Server) flushAll(w *bufio.Writer, args []string) {
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+	var delay int64
+	if len(args) > 0 {
+		var err error
+		if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil || len(args) > 1 {
+			w.WriteString(errBadFormat)
+			return
+		}
+	}
+	if delay > 0 {
+		time.AfterFunc(time.Duration(delay)*time.Second, s.cache.Flush)
+	} else {
+		s.cache.Flush()
+	}
+	if !noreply {
+		w.WriteString(replyOK)
+	}
+}
+
+// set with ttl, return false if the cache does not keep value, like an Item set to an arena cache
+func (s *Server) set(key string, value interface{}, ttl int64) bool {
+	s.cache.SetWithExpire(key, value, ttl)
+	_, has := s.cache.TTL(key)
+	return has
+}
+
+// remainingTTL return seconds to live of key rounded up, 0 if not exists
+func (s *Server) remainingTTL(key string) int64 {
+	ttl, has := s.cache.TTL(key)
+	if !has {
+		return 0
+	}
+	return int64((ttl + time.Second - 1) / time.Second)
+}
+
+// toTTL convert exptime to seconds to live, 0 never expires, expired is true if the item expires at once
+func toTTL(exptime int64) (ttl int64, expired bool) {
+	switch {
+	case exptime < 0:
+		return 0, true
+	case exptime == 0:
+		return neverExpireTTL, false
+	case exptime <= maxRelativeExptime:
+		return exptime, false
+	}
+	// unix timestamp
+	ttl = exptime - time.Now().Unix()
+	return ttl, ttl <= 0
+}
+
+// validKey return whether key is not longer than 250 bytes and has no control chars
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Item is a value with flags stored by memcache commands
+type Item struct {
+	Flags uint32
+	Data  []byte
+}
+
+func init() {
+	// items can be saved by GobCodec
+	gob.Register(Item{})
+}
+
+// encodeItem return data if flags is 0, else an Item
+func encodeItem(flags uint32, data []byte) interface{} {
+	if flags == 0 {
+		return data
+	}
+	return Item{Flags: flags, Data: data}
+}
+
+// decodeItem return flags and data of a value, values not Item have flags 0
+func decodeItem(value interface{}) (uint32, []byte) {
+	switch v := value.(type) {
+	case Item:
+		return v.Flags, v.Data
+	case []byte:
+		return 0, v
+	case string:
+		return 0, []byte(v)
+	default:
+		return 0, []byte(fmt.Sprint(v))
+	}
+}
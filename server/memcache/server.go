@@ -0,0 +1,191 @@
+// Package memcache serve a Cache by the memcached text protocol, so memcached clients can use it as a sidecar.
+//
+//	server := memcache.NewServer(cache)
+//	go server.ListenAndServe(":11211")
+//	defer server.Close()
+//
+// Commands: get, gets, set, add, replace, append, prepend, cas, delete, incr, decr, touch, stats, flush_all, version and quit.
+// Values with flags 0 are stored as []byte, others as Item. Values set by go code are read with flags 0.
+// An arena cache only keeps []byte, so it replies NOT_STORED to items with flags.
+// Exptime 0 means never expire like memcached, the global ttl of cache is not used. Exptime larger than 30 days
+// is a unix timestamp.
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/MoeYang/go-localcache"
+	"github.com/MoeYang/go-localcache/datastruct/lock"
+)
+
+const keyLockCount = 256
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("memcache: server closed")
+
+// Server serve a cache by the memcached text protocol
+type Server struct {
+	cache localcache.Cache
+	// keyLock make read-modify-write commands of the same key serial
+	keyLock *lock.Locker
+	onError func(err error)
+	started time.Time
+
+	lock      sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Option of Server
+type Option func(*Server)
+
+// WithErrorHandler set the func to handle errors of accepting and connections, default log them
+func WithErrorHandler(onError func(err error)) Option {
+	return func(s *Server) {
+		if onError != nil {
+			s.onError = onError
+		}
+	}
+}
+
+// NewServer return a server of cache
+func NewServer(cache localcache.Cache, options ...Option) *Server {
+	s := &Server{
+		cache:     cache,
+		keyLock:   lock.NewLocker(keyLockCount),
+		onError:   defaultOnError,
+		started:   time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+// ListenAndServe listen on tcp addr and serve
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accept connections on l until Close, it always return a non-nil error
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				s.onError(err)
+				continue
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stop listeners, close connections and wait them exit
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// track add listener or conn to close them when Close, return false if closed
+func (s *Server) track(l net.Listener, conn net.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return false
+	}
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+	if conn != nil {
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+	}
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
+// serveConn read commands and write replies until the client quit or error
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		s.wg.Done()
+	}()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if err == errLineSize {
+				w.WriteString("CLIENT_ERROR line too long\r\n")
+				w.Flush()
+			} else if err != io.EOF && !s.isClosed() {
+				s.onError(err)
+			}
+			return
+		}
+		quit, err := s.exec(r, w, line)
+		if err != nil {
+			// the data block can not be read
+			return
+		}
+		// replies of a pipeline are flushed together
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+func defaultOnError(err error) {
+	log.Printf("localcache/memcache: %v", err)
+}
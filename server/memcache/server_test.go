@@ -0,0 +1,185 @@
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MoeYang/go-localcache"
+)
+
+// client send command lines and read replies
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// do send lines and read n reply lines joined by "|"
+func (c *client) do(n int, lines ...string) string {
+	for _, line := range lines {
+		fmt.Fprintf(c.conn, "%s\r\n", line)
+	}
+	replies := make([]string, n)
+	for i := range replies {
+		line, _ := c.r.ReadString('\n')
+		replies[i] = strings.TrimSuffix(line, "\r\n")
+	}
+	return strings.Join(replies, "|")
+}
+
+func newTestServer(t *testing.T, cache localcache.Cache) *client {
+	server := NewServer(cache)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func TestServerCommands(t *testing.T) {
+	caches := map[string]localcache.Cache{
+		"local": localcache.NewLocalCache(localcache.WithStatist(true)),
+		"arena": localcache.NewArenaCache(1<<20, localcache.WithStatist(true)),
+	}
+	for name, cache := range caches {
+		c := newTestServer(t, cache)
+		cases := []struct {
+			lines []string
+			n     int
+			want  string
+		}{
+			{[]string{"get a"}, 1, "END"},
+			{[]string{"set a 5 0 3", "abc"}, 1, "STORED"},
+			{[]string{"get a b"}, 3, "VALUE a 5 3|abc|END"},
+			{[]string{"add a 0 0 1", "x"}, 1, "NOT_STORED"},
+			{[]string{"add b 0 100 1", "1"}, 1, "STORED"},
+			{[]string{"replace c 0 0 1", "x"}, 1, "NOT_STORED"},
+			{[]string{"append a 0 0 2", "de"}, 1, "STORED"},
+			{[]string{"prepend a 0 0 1", "_"}, 1, "STORED"},
+			{[]string{"get a"}, 3, "VALUE a 5 6|_abcde|END"},
+			{[]string{"incr b 10"}, 1, "11"},
+			{[]string{"decr b 20"}, 1, "0"},
+			{[]string{"incr a 1"}, 1, "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+			{[]string{"incr c 1"}, 1, "NOT_FOUND"},
+			{[]string{"touch b 200"}, 1, "TOUCHED"},
+			{[]string{"touch c 200"}, 1, "NOT_FOUND"},
+			{[]string{"delete b"}, 1, "DELETED"},
+			{[]string{"delete b"}, 1, "NOT_FOUND"},
+			{[]string{"set c 0 0 1 noreply", "1", "get c"}, 3, "VALUE c 0 1|1|END"},
+			{[]string{"set c 0 -1 1", "1", "get c"}, 2, "STORED|END"},
+			{[]string{"cas c 0 0 1 1", "1"}, 1, "NOT_FOUND"},
+			{[]string{"set k" + strings.Repeat("x", 250) + " 0 0 1", "1"}, 1, "CLIENT_ERROR bad command line format"},
+			{[]string{"foo"}, 1, "ERROR"},
+			{[]string{"flush_all"}, 1, "OK"},
+			{[]string{"get a"}, 1, "END"},
+		}
+		// an arena cache only keeps items with flags 0
+		flags := " 5 "
+		if name == "arena" {
+			flags = " 0 "
+		}
+		for i, cs := range cases {
+			for j := range cs.lines {
+				cs.lines[j] = strings.Replace(cs.lines[j], " 5 ", flags, 1)
+			}
+			cs.want = strings.Replace(cs.want, " 5 ", flags, -1)
+			if got := c.do(cs.n, cs.lines...); got != cs.want {
+				t.Errorf("TestServerCommands%d %s %q = %q, want %q", i, name, cs.lines, got, cs.want)
+			}
+		}
+		if got := c.do(1, "version"); !strings.HasPrefix(got, "VERSION ") {
+			t.Errorf("TestServerCommands %s version %q", name, got)
+		}
+		if name == "arena" {
+			if got := c.do(2, "set d 5 0 1", "1", "get d"); got != "NOT_STORED|END" {
+				t.Errorf("TestServerCommands arena set with flags %q", got)
+			}
+		}
+		cache.Stop()
+	}
+}
+
+func TestServerCas(t *testing.T) {
+	cache := localcache.NewLocalCache()
+	defer cache.Stop()
+	c := newTestServer(t, cache)
+	c.do(1, "set a 1 0 1", "1")
+	var cas uint64
+	reply := c.do(3, "gets a")
+	if _, err := fmt.Sscanf(reply, "VALUE a 1 1 %d|1|END", &cas); err != nil || cas == 0 {
+		t.Fatalf("TestServerCas1 gets %q", reply)
+	}
+	if got := c.do(1, fmt.Sprintf("cas a 2 0 1 %d", cas), "2"); got != "STORED" {
+		t.Errorf("TestServerCas2 cas %q", got)
+	}
+	// the cas unique changed
+	if got := c.do(1, fmt.Sprintf("cas a 2 0 1 %d", cas), "3"); got != "EXISTS" {
+		t.Errorf("TestServerCas3 cas %q", got)
+	}
+	if got := c.do(3, "get a"); got != "VALUE a 2 1|2|END" {
+		t.Errorf("TestServerCas4 get %q", got)
+	}
+	// values set by go code have flags 0
+	cache.Set("g", 42)
+	if got := c.do(3, "get g"); got != "VALUE g 0 2|42|END" {
+		t.Errorf("TestServerCas5 get g %q", got)
+	}
+	// []byte set by go code is the whole data, not flags before data
+	cache.Set("b", []byte("abcdef"))
+	if got := c.do(3, "get b"); got != "VALUE b 0 6|abcdef|END" {
+		t.Errorf("TestServerCas6 get b %q", got)
+	}
+	// touch keeps the cas unique
+	reply = c.do(3, "gets a")
+	if _, err := fmt.Sscanf(reply, "VALUE a 2 1 %d|2|END", &cas); err != nil {
+		t.Fatalf("TestServerCas7 gets %q", reply)
+	}
+	if got := c.do(1, "touch a 100"); got != "TOUCHED" {
+		t.Errorf("TestServerCas8 touch %q", got)
+	}
+	if got := c.do(3, "gets a"); got != fmt.Sprintf("VALUE a 2 1 %d|2|END", cas) {
+		t.Errorf("TestServerCas9 gets after touch %q, want cas %d", got, cas)
+	}
+	if ttl, _ := cache.TTL("a"); ttl <= 90*time.Second {
+		t.Errorf("TestServerCas10 ttl %v after touch", ttl)
+	}
+	if got := c.do(1, "stats"); !strings.HasPrefix(got, "STAT pid ") {
+		t.Errorf("TestServerCas11 stats %q", got)
+	}
+}
+
+func TestServerExptime(t *testing.T) {
+	cache := localcache.NewLocalCache(localcache.WithGlobalTTL(1))
+	defer cache.Stop()
+	c := newTestServer(t, cache)
+	// exptime 0 never expires, not the global ttl
+	c.do(1, "set a 0 0 1", "1")
+	if ttl, has := cache.TTL("a"); !has || ttl < 365*24*time.Hour {
+		t.Errorf("TestServerExptime1 ttl of a %v", ttl)
+	}
+	c.do(1, "set b 0 10 1", "1")
+	if got := c.do(1, "touch b 0"); got != "TOUCHED" {
+		t.Errorf("TestServerExptime2 touch %q", got)
+	}
+	if ttl, _ := cache.TTL("b"); ttl < 365*24*time.Hour {
+		t.Errorf("TestServerExptime3 ttl of b %v after touch 0", ttl)
+	}
+	// exptime larger than 30 days is a unix timestamp
+	c.do(1, fmt.Sprintf("set c 0 %d 1", time.Now().Unix()+100), "1")
+	if ttl, _ := cache.TTL("c"); ttl < 90*time.Second || ttl > 100*time.Second {
+		t.Errorf("TestServerExptime4 ttl of c %v", ttl)
+	}
+	if got := c.do(2, fmt.Sprintf("set d 0 %d 1", maxRelativeExptime+1), "1", "get d"); got != "STORED|END" {
+		t.Errorf("TestServerExptime5 timestamp in the past %q", got)
+	}
+}
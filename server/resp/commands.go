@@ -0,0 +1,350 @@
+package resp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoeYang/go-localcache/common"
+)
+
+const (
+	errSyntax     = "ERR syntax error"
+	errNotInteger = "ERR value is not an integer or out of range"
+	errExpireTime = "ERR invalid expire time in 'set' command"
+	errOverflow   = "ERR increment or decrement would overflow"
+)
+
+// command is a handler and its arity, arity is the count of args include name, -n means at least n
+type command struct {
+	arity  int
+	handle func(s *Server, w *writer, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":      {2, (*Server).get},
+		"set":      {-3, (*Server).set},
+		"del":      {-2, (*Server).del},
+		"exists":   {-2, (*Server).exists},
+		"ttl":      {2, (*Server).ttl},
+		"pttl":     {2, (*Server).pttl},
+		"expire":   {3, (*Server).expire},
+		"incr":     {2, (*Server).incr},
+		"incrby":   {3, (*Server).incrBy},
+		"decr":     {2, (*Server).decr},
+		"decrby":   {3, (*Server).decrBy},
+		"mget":     {-2, (*Server).mget},
+		"mset":     {-3, (*Server).mset},
+		"keys":     {2, (*Server).keys},
+		"dbsize":   {1, (*Server).dbSize},
+		"flushall": {-1, (*Server).flushAll},
+		"info":     {-1, (*Server).info},
+		"ping":     {-1, (*Server).ping},
+		"echo":     {2, (*Server).echo},
+		"select":   {2, (*Server).selectDB},
+		"command":  {-1, (*Server).command},
+	}
+}
+
+func (s *Server) get(w *writer, args [][]byte) {
+	value, has := s.cache.Get(string(args[1]))
+	if !has {
+		w.writeNil()
+		return
+	}
+	w.writeBulk(toBytes(value))
+}
+
+// set key value [EX seconds|PX milliseconds] [NX|XX]
+func (s *Server) set(w *writer, args [][]byte) {
+	key := string(args[1])
+	var ttl int64
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); opt {
+		case "ex", "px":
+			if ttl != 0 || i+1 == len(args) {
+				w.writeError(errSyntax)
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				w.writeError(errNotInteger)
+				return
+			}
+			if n <= 0 || n > math.MaxInt32 {
+				w.writeError(errExpireTime)
+				return
+			}
+			ttl = n
+			if opt == "px" {
+				// ttl of cache is in seconds, round up
+				ttl = (n + 999) / 1000
+			}
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		default:
+			w.writeError(errSyntax)
+			return
+		}
+	}
+	if nx && xx {
+		w.writeError(errSyntax)
+		return
+	}
+	s.keyLock.Lock(key)
+	defer s.keyLock.Unlock(key)
+	if nx || xx {
+		if _, has := s.cache.TTL(key); has == nx {
+			w.writeNil()
+			return
+		}
+	}
+	if ttl > 0 {
+		s.cache.SetWithExpire(key, args[2], ttl)
+	} else {
+		s.cache.Set(key, args[2])
+	}
+	w.writeStatus("OK")
+}
+
+func (s *Server) del(w *writer, args [][]byte) {
+	var count int64
+	for _, key := range args[1:] {
+		if s.cache.Del(string(key)) {
+			count++
+		}
+	}
+	w.writeInt(count)
+}
+
+func (s *Server) exists(w *writer, args [][]byte) {
+	var count int64
+	for _, key := range args[1:] {
+		// TTL does not count hits
+		if _, has := s.cache.TTL(string(key)); has {
+			count++
+		}
+	}
+	w.writeInt(count)
+}
+
+// ttl return remaining seconds, -2 if key not exists
+func (s *Server) ttl(w *writer, args [][]byte) {
+	ttl, has := s.cache.TTL(string(args[1]))
+	if !has {
+		w.writeInt(-2)
+		return
+	}
+	w.writeInt(int64((ttl + 500*time.Millisecond) / time.Second))
+}
+
+func (s *Server) pttl(w *writer, args [][]byte) {
+	ttl, has := s.cache.TTL(string(args[1]))
+	if !has {
+		w.writeInt(-2)
+		return
+	}
+	w.writeInt(int64(ttl / time.Millisecond))
+}
+
+// expire set seconds to live of key, delete it if seconds <= 0
+func (s *Server) expire(w *writer, args [][]byte) {
+	key := string(args[1])
+	seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		w.writeError(errNotInteger)
+		return
+	}
+	var has bool
+	if seconds <= 0 {
+		has = s.cache.Del(key)
+	} else {
+		// only the ttl changes, the value, version and tags are kept
+		has = s.cache.Touch(key, seconds)
+	}
+	if has {
+		w.writeInt(1)
+	} else {
+		w.writeInt(0)
+	}
+}
+
+func (s *Server) incr(w *writer, args [][]byte) {
+	s.incrKey(w, string(args[1]), 1)
+}
+
+func (s *Server) decr(w *writer, args [][]byte) {
+	s.incrKey(w, string(args[1]), -1)
+}
+
+func (s *Server) incrBy(w *writer, args [][]byte) {
+	by, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		w.writeError(errNotInteger)
+		return
+	}
+	s.incrKey(w, string(args[1]), by)
+}
+
+func (s *Server) decrBy(w *writer, args [][]byte) {
+	by, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil || by == math.MinInt64 {
+		w.writeError(errNotInteger)
+		return
+	}
+	s.incrKey(w, string(args[1]), -by)
+}
+
+// incrKey add by to the integer value of key under keyLock, a key not exists is 0, the ttl of key is kept
+func (s *Server) incrKey(w *writer, key string, by int64) {
+	s.keyLock.Lock(key)
+	defer s.keyLock.Unlock(key)
+	var n int64
+	value, has := s.cache.Get(key)
+	if has {
+		var err error
+		if n, err = strconv.ParseInt(string(toBytes(value)), 10, 64); err != nil {
+			w.writeError(errNotInteger)
+			return
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		w.writeError(errOverflow)
+		return
+	}
+	n += by
+	data := []byte(strconv.FormatInt(n, 10))
+	if ttl, ok := s.cache.TTL(key); has && ok {
+		s.cache.SetWithExpire(key, data, int64((ttl+time.Second-1)/time.Second))
+	} else {
+		s.cache.Set(key, data)
+	}
+	w.writeInt(n)
+}
+
+func (s *Server) mget(w *writer, args [][]byte) {
+	keys := make([]string, len(args)-1)
+	for i, key := range args[1:] {
+		keys[i] = string(key)
+	}
+	values := s.cache.GetMulti(keys)
+	w.writeArrayLen(len(keys))
+	for _, key := range keys {
+		if value, has := values[key]; has {
+			w.writeBulk(toBytes(value))
+		} else {
+			w.writeNil()
+		}
+	}
+}
+
+func (s *Server) mset(w *writer, args [][]byte) {
+	if len(args)%2 != 1 {
+		w.writeError("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	for i := 1; i < len(args); i += 2 {
+		key := string(args[i])
+		s.keyLock.Lock(key)
+		s.cache.Set(key, args[i+1])
+		s.keyLock.Unlock(key)
+	}
+	w.writeStatus("OK")
+}
+
+func (s *Server) keys(w *writer, args [][]byte) {
+	pattern := string(args[1])
+	var keys []string
+	for _, key := range s.cache.Keys() {
+		if common.MatchGlob(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	w.writeArrayLen(len(keys))
+	for _, key := range keys {
+		w.writeBulk([]byte(key))
+	}
+}
+
+func (s *Server) dbSize(w *writer, args [][]byte) {
+	w.writeInt(int64(s.cache.Len()))
+}
+
+// flushAll ignore ASYNC and SYNC, cache is flushed synchronously
+func (s *Server) flushAll(w *writer, args [][]byte) {
+	s.cache.Flush()
+	w.writeStatus("OK")
+}
+
+// info write Statistic of cache as "name:value" lines sorted by name
+func (s *Server) info(w *writer, args [][]byte) {
+	stats := s.cache.Statistic()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("# Keyspace\r\n")
+	fmt.Fprintf(&b, "keys:%d\r\n", s.cache.Len())
+	b.WriteString("\r\n# Stats\r\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s:%v\r\n", name, stats[name])
+	}
+	w.writeBulk([]byte(b.String()))
+}
+
+func (s *Server) ping(w *writer, args [][]byte) {
+	switch len(args) {
+	case 1:
+		w.writeStatus("PONG")
+	case 2:
+		w.writeBulk(args[1])
+	default:
+		w.writeError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) echo(w *writer, args [][]byte) {
+	w.writeBulk(args[1])
+}
+
+// selectDB only db 0 exists
+func (s *Server) selectDB(w *writer, args [][]byte) {
+	if string(args[1]) != "0" {
+		w.writeError("ERR DB index is out of range")
+		return
+	}
+	w.writeStatus("OK")
+}
+
+// command reply an empty array, so clients ask for command docs like redis-cli work
+func (s *Server) command(w *writer, args [][]byte) {
+	w.writeArrayLen(0)
+}
+
+// toBytes format values set by go code, values set by clients are []byte already
+func toBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	case int:
+		return []byte(strconv.Itoa(v))
+	case int64:
+		return []byte(strconv.FormatInt(v, 10))
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,185 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxArgs     = 1 << 20
+	maxBulkLen  = 512 << 20
+	maxLineSize = 64 << 10
+	// lengths are sent by clients, buffers larger than these grow while reading so a header alone allocates little
+	maxArgsPrealloc = 1 << 10
+	maxBulkPrealloc = 64 << 10
+)
+
+var (
+	errProtocol = errors.New("Protocol error")
+	errLineSize = errors.New("Protocol error: too big inline request")
+)
+
+// reader read commands of clients, a command is an array of bulk strings or an inline line
+type reader struct {
+	r *bufio.Reader
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{r: bufio.NewReader(r)}
+}
+
+// buffered return whether there are more bytes to read without blocking, used to flush replies of a pipeline once
+func (r *reader) buffered() bool {
+	return r.r.Buffered() > 0
+}
+
+// readCommand return args of the next command, args is empty for an empty line
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		// inline command like telnet "GET key"
+		fields := strings.Fields(string(line))
+		args := make([][]byte, len(fields))
+		for i, field := range fields {
+			args[i] = []byte(field)
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, errProtocol
+	}
+	// *0 is an empty command
+	size := n
+	if size > maxArgsPrealloc {
+		size = maxArgsPrealloc
+	}
+	args := make([][]byte, 0, size)
+	for i := 0; i < n; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk read $len\r\ndata\r\n
+func (r *reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, errProtocol
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxBulkLen {
+		return nil, errProtocol
+	}
+	data, err := r.readN(n + 2)
+	if err != nil {
+		return nil, err
+	}
+	if data[n] != '\r' || data[n+1] != '\n' {
+		return nil, errProtocol
+	}
+	return data[:n], nil
+}
+
+// readN read n bytes, a large n is read into a growing buffer so only the bytes sent are allocated
+func (r *reader) readN(n int) ([]byte, error) {
+	if n <= maxBulkPrealloc {
+		data := make([]byte, n)
+		_, err := io.ReadFull(r.r, data)
+		return data, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(maxBulkPrealloc)
+	if _, err := io.CopyN(&buf, r.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readLine read a line without \r\n
+func (r *reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := r.r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, part...)
+		if len(line) > maxLineSize {
+			return nil, errLineSize
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// writer write replies to clients
+type writer struct {
+	w *bufio.Writer
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{w: bufio.NewWriter(w)}
+}
+
+func (w *writer) flush() error {
+	return w.w.Flush()
+}
+
+// writeStatus write a simple string like +OK
+func (w *writer) writeStatus(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// writeError write an error like -ERR msg
+func (w *writer) writeError(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) writeInt(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) writeBulk(b []byte) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// writeNil write a nil bulk string
+func (w *writer) writeNil() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// writeArrayLen write the header of an array, then write n items
+func (w *writer) writeArrayLen(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
@@ -0,0 +1,205 @@
+// Package resp serve a Cache by the redis protocol, so redis clients can use it as a sidecar.
+//
+//	server := resp.NewServer(cache)
+//	go server.ListenAndServe(":6379")
+//	defer server.Close()
+//
+// Commands: GET, SET key value [EX seconds|PX milliseconds], DEL, EXISTS, TTL, PTTL, EXPIRE, INCR, INCRBY, DECR, DECRBY,
+// MGET, MSET, KEYS, FLUSHALL, INFO, DBSIZE, PING, ECHO, SELECT, QUIT and COMMAND.
+// Every key has a ttl, SET without EX or PX uses the global ttl of cache.
+package resp
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/MoeYang/go-localcache"
+	"github.com/MoeYang/go-localcache/datastruct/lock"
+)
+
+const keyLockCount = 256
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Server serve a cache by the redis protocol
+type Server struct {
+	cache localcache.Cache
+	// keyLock make read-modify-write commands of the same key serial
+	keyLock *lock.Locker
+	onError func(err error)
+
+	lock      sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Option of Server
+type Option func(*Server)
+
+// WithErrorHandler set the func to handle errors of accepting and connections, default log them
+func WithErrorHandler(onError func(err error)) Option {
+	return func(s *Server) {
+		if onError != nil {
+			s.onError = onError
+		}
+	}
+}
+
+// NewServer return a server of cache, values set by clients are stored as []byte
+func NewServer(cache localcache.Cache, options ...Option) *Server {
+	s := &Server{
+		cache:     cache,
+		keyLock:   lock.NewLocker(keyLockCount),
+		onError:   defaultOnError,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+// ListenAndServe listen on tcp addr and serve
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accept connections on l until Close, it always return a non-nil error
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				s.onError(err)
+				continue
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stop listeners, close connections and wait them exit
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// track add listener or conn to close them when Close, return false if closed
+func (s *Server) track(l net.Listener, conn net.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return false
+	}
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+	if conn != nil {
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+	}
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
+// serveConn read commands and write replies until the client quit or error
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		s.wg.Done()
+	}()
+	r := newReader(conn)
+	w := newWriter(conn)
+	for {
+		args, err := r.readCommand()
+		if err != nil {
+			if err == errProtocol || err == errLineSize {
+				w.writeError("ERR " + err.Error())
+				w.flush()
+			} else if err != io.EOF && !s.isClosed() {
+				s.onError(err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.exec(w, args)
+		// replies of a pipeline are flushed together
+		if !r.buffered() || quit {
+			if err := w.flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// exec run a command and write its reply, return true if the client quit
+func (s *Server) exec(w *writer, args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	if name == "quit" {
+		w.writeStatus("OK")
+		return true
+	}
+	cmd, has := commands[name]
+	if !has {
+		w.writeError("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		w.writeError("ERR wrong number of arguments for '" + name + "' command")
+		return false
+	}
+	cmd.handle(s, w, args)
+	return false
+}
+
+func defaultOnError(err error) {
+	log.Printf("localcache/resp: %v", err)
+}
@@ -0,0 +1,235 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MoeYang/go-localcache"
+)
+
+// client send commands and parse replies, errors are returned as "-ERR ..." strings and nil bulk as nil
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) do(args ...string) interface{} {
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.read()
+}
+
+func (c *client) read() interface{} {
+	line, _ := c.r.ReadString('\n')
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil
+	}
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return line
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		data := make([]byte, n+2)
+		c.r.Read(data)
+		return string(data[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = c.read()
+		}
+		return items
+	}
+	return nil
+}
+
+// span is a range of integer replies
+type span struct {
+	min, max int64
+}
+
+func newTestServer(t *testing.T) (*client, localcache.Cache) {
+	cache := localcache.NewLocalCache(localcache.WithStatist(true))
+	t.Cleanup(cache.Stop)
+	server := NewServer(cache)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{conn: conn, r: bufio.NewReader(conn)}, cache
+}
+
+func TestServerCommands(t *testing.T) {
+	c, cache := newTestServer(t)
+	cases := []struct {
+		args []string
+		want interface{}
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"GET", "a"}, nil},
+		{[]string{"SET", "a", "1"}, "OK"},
+		{[]string{"GET", "a"}, "1"},
+		{[]string{"SET", "a", "2", "NX"}, nil},
+		{[]string{"SET", "b", "2", "XX"}, nil},
+		{[]string{"SET", "b", "2", "EX", "100"}, "OK"},
+		{[]string{"TTL", "b"}, span{99, 100}},
+		{[]string{"SET", "c", "3", "PX", "1500"}, "OK"},
+		{[]string{"PTTL", "c"}, span{1000, 2000}},
+		{[]string{"SET", "c", "3", "EX", "0"}, "-" + errExpireTime},
+		{[]string{"TTL", "x"}, int64(-2)},
+		{[]string{"EXPIRE", "b", "200"}, int64(1)},
+		{[]string{"TTL", "b"}, span{199, 200}},
+		{[]string{"EXPIRE", "x", "200"}, int64(0)},
+		{[]string{"EXISTS", "a", "b", "x"}, int64(2)},
+		{[]string{"INCRBY", "a", "10"}, int64(11)},
+		{[]string{"INCR", "n"}, int64(1)},
+		{[]string{"DECRBY", "n", "3"}, int64(-2)},
+		{[]string{"INCRBY", "b", "x"}, "-" + errNotInteger},
+		{[]string{"SET", "s", "abc"}, "OK"},
+		{[]string{"INCR", "s"}, "-" + errNotInteger},
+		{[]string{"MSET", "m1", "1", "m2", "2"}, "OK"},
+		{[]string{"MGET", "m1", "x", "m2"}, []interface{}{"1", nil, "2"}},
+		{[]string{"MSET", "m1"}, "-ERR wrong number of arguments for 'mset' command"},
+		{[]string{"KEYS", "m*"}, nil},
+		{[]string{"DEL", "m1", "m2", "x"}, int64(2)},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"FOO"}, "-ERR unknown command 'FOO'"},
+		{[]string{"FLUSHALL"}, "OK"},
+		{[]string{"DBSIZE"}, int64(0)},
+	}
+	for i, cs := range cases {
+		got := c.do(cs.args...)
+		if cs.args[0] == "KEYS" {
+			if items, _ := got.([]interface{}); len(items) != 2 {
+				t.Errorf("TestServerCommands%d %v = %v", i, cs.args, got)
+			}
+			continue
+		}
+		if want, ok := cs.want.(span); ok {
+			// expire time of cache is in seconds
+			if n, _ := got.(int64); n < want.min || n > want.max {
+				t.Errorf("TestServerCommands%d %v = %v, want in %v", i, cs.args, got, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, cs.want) {
+			t.Errorf("TestServerCommands%d %v = %#v, want %#v", i, cs.args, got, cs.want)
+		}
+	}
+	// values set by go code
+	cache.Set("g", 42)
+	if got := c.do("GET", "g"); got != "42" {
+		t.Errorf("TestServerCommands get g = %v", got)
+	}
+	if info, _ := c.do("INFO").(string); !strings.Contains(info, "\r\nhit:") {
+		t.Errorf("TestServerCommands info %q", info)
+	}
+}
+
+func TestServerPipelineAndInline(t *testing.T) {
+	c, _ := newTestServer(t)
+	// pipeline of a RESP command and an inline command
+	fmt.Fprint(c.conn, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\nGET k\r\n")
+	if got := c.read(); got != "OK" {
+		t.Errorf("TestServerPipelineAndInline1 set %v", got)
+	}
+	if got := c.read(); got != "v" {
+		t.Errorf("TestServerPipelineAndInline2 get %v", got)
+	}
+	fmt.Fprint(c.conn, "*1\r\n$x\r\n")
+	if got := c.read(); got != "-ERR Protocol error" {
+		t.Errorf("TestServerPipelineAndInline3 %v", got)
+	}
+}
+
+func TestServerMalformedHeader(t *testing.T) {
+	c, _ := newTestServer(t)
+	// an empty multibulk is skipped
+	fmt.Fprint(c.conn, "*0\r\nPING\r\n")
+	if got := c.read(); got != "PONG" {
+		t.Errorf("TestServerMalformedHeader1 ping %v", got)
+	}
+	fmt.Fprint(c.conn, "*-5\r\n")
+	if got := c.read(); got != "-ERR Protocol error" {
+		t.Errorf("TestServerMalformedHeader2 %v", got)
+	}
+	// the server is still serving
+	conn, err := net.Dial("tcp", c.conn.RemoteAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	other := &client{conn: conn, r: bufio.NewReader(conn)}
+	if got := other.do("PING"); got != "PONG" {
+		t.Errorf("TestServerMalformedHeader3 ping %v", got)
+	}
+}
+
+func TestReaderLargeHeader(t *testing.T) {
+	// lengths in headers do not allocate before the data is sent
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for _, header := range []string{"*1048576\r\n", "*1\r\n$536870911\r\nabc"} {
+		if _, err := newReader(strings.NewReader(header)).readCommand(); err == nil {
+			t.Errorf("TestReaderLargeHeader1 %q no error", header)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 10<<20 {
+		t.Errorf("TestReaderLargeHeader2 allocated %d bytes", alloc)
+	}
+	// a bulk larger than the preallocated buffer is read whole
+	data := strings.Repeat("x", maxBulkPrealloc*3)
+	args, err := newReader(strings.NewReader(fmt.Sprintf("*2\r\n$3\r\nSET\r\n$%d\r\n%s\r\n", len(data), data))).readCommand()
+	if err != nil || len(args) != 2 || string(args[1]) != data {
+		t.Errorf("TestReaderLargeHeader3 read %d args, err=%v", len(args), err)
+	}
+}
+
+func TestServerExpire(t *testing.T) {
+	c, cache := newTestServer(t)
+	cache.SetWithTags("k", []byte("v"), 10, "t")
+	_, version, _ := cache.GetWithVersion("k")
+	hits := cache.Stats().Hits
+	if got := c.do("EXPIRE", "k", "100"); got != int64(1) {
+		t.Errorf("TestServerExpire1 expire %v", got)
+	}
+	// only the ttl changes
+	if ttl, _ := cache.TTL("k"); ttl <= 90*time.Second {
+		t.Errorf("TestServerExpire2 ttl %v", ttl)
+	}
+	if got := cache.Stats().Hits; got != hits {
+		t.Errorf("TestServerExpire3 hits %d <> %d", got, hits)
+	}
+	if _, got, _ := cache.GetWithVersion("k"); got != version {
+		t.Errorf("TestServerExpire4 version %d <> %d", got, version)
+	}
+	if n := cache.InvalidateTag("t"); n != 1 {
+		t.Errorf("TestServerExpire5 tag of k dropped, invalidate %d", n)
+	}
+}
@@ -1,22 +1,80 @@
 package localcache
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type statist interface {
 	// hitIncr add hit count
 	hitIncr()
 	// missIncr add miss count
 	missIncr()
+	// setIncr add set count
+	setIncr()
+	// delIncr add count of keys deleted by user
+	delIncr()
+	// evictIncr add count of keys evicted to free space
+	evictIncr(cause evictionCause)
+	// expireIncr add count of keys deleted because expired
+	expireIncr()
+	// loadIncr add load count and load time
+	loadIncr(cost time.Duration, err error)
+	// sharedLoadIncr add count of loads which share result of another in-flight load
+	sharedLoadIncr()
+	// backpressureIncr add count of write buffer full
+	backpressureIncr()
+	// diskHitIncr add count of hits promoted from disk tier
+	diskHitIncr()
 	GetHitCount() uint64
 	GetMissCount() uint64
 	GetHitRate() float64
+	GetBackpressureCount() uint64
+	// fill the counters to stats
+	fill(stats *Stats)
 }
 
+// LoadLatencyBuckets are the upper bounds of buckets of Stats.LoadLatency
+var LoadLatencyBuckets = [...]time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// LoadLatency count loads in every bucket of LoadLatencyBuckets, the last one is for loads slower than all bounds
+type LoadLatency [len(LoadLatencyBuckets) + 1]uint64
+
+// evictionCause is why a key is evicted
+type evictionCause int
+
+const (
+	evictByCapacity    evictionCause = iota // evicted by policy when cache is full
+	evictByWriteBuffer                      // set is undone by WriteBufferDropOldest
+	evictionCauseCount
+)
+
 // statisCaculator implement a cache statist
 type statisCaculator struct {
 	needStatist bool
 	hitCount    uint64
 	missCount   uint64
+	setCount    uint64
+	delCount    uint64
+	evictCount  [evictionCauseCount]uint64
+	expireCount uint64
+
+	loadSuccessCount uint64
+	loadFailureCount uint64
+	loadTime         int64 // nanoseconds
+	loadLatency      LoadLatency
+	sharedLoadCount  uint64
+	diskHitCount     uint64
+
+	// backpressureCount is counted even needStatist is false, it only happens on slow path
+	backpressureCount uint64
+
+	// hits, misses and loads of the last 15 minutes
+	window statisWindow
 }
 
 // newstatisCaculator needs a param whether need to do cache statis
@@ -29,6 +87,7 @@ func (s *statisCaculator) hitIncr() {
 		return
 	}
 	atomic.AddUint64(&s.hitCount, 1)
+	s.window.hitIncr()
 }
 
 func (s *statisCaculator) missIncr() {
@@ -36,6 +95,71 @@ func (s *statisCaculator) missIncr() {
 		return
 	}
 	atomic.AddUint64(&s.missCount, 1)
+	s.window.missIncr()
+}
+
+func (s *statisCaculator) setIncr() {
+	if !s.needStatist {
+		return
+	}
+	atomic.AddUint64(&s.setCount, 1)
+}
+
+func (s *statisCaculator) delIncr() {
+	if !s.needStatist {
+		return
+	}
+	atomic.AddUint64(&s.delCount, 1)
+}
+
+func (s *statisCaculator) evictIncr(cause evictionCause) {
+	if !s.needStatist {
+		return
+	}
+	atomic.AddUint64(&s.evictCount[cause], 1)
+}
+
+func (s *statisCaculator) expireIncr() {
+	if !s.needStatist {
+		return
+	}
+	atomic.AddUint64(&s.expireCount, 1)
+}
+
+func (s *statisCaculator) loadIncr(cost time.Duration, err error) {
+	if !s.needStatist {
+		return
+	}
+	if err == nil {
+		atomic.AddUint64(&s.loadSuccessCount, 1)
+	} else {
+		atomic.AddUint64(&s.loadFailureCount, 1)
+	}
+	atomic.AddInt64(&s.loadTime, int64(cost))
+	s.window.loadIncr(cost)
+	i := 0
+	for i < len(LoadLatencyBuckets) && cost > LoadLatencyBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&s.loadLatency[i], 1)
+}
+
+func (s *statisCaculator) sharedLoadIncr() {
+	if !s.needStatist {
+		return
+	}
+	atomic.AddUint64(&s.sharedLoadCount, 1)
+}
+
+func (s *statisCaculator) diskHitIncr() {
+	if !s.needStatist {
+		return
+	}
+	atomic.AddUint64(&s.diskHitCount, 1)
+}
+
+func (s *statisCaculator) backpressureIncr() {
+	atomic.AddUint64(&s.backpressureCount, 1)
 }
 
 func (s *statisCaculator) GetHitCount() uint64 {
@@ -53,3 +177,170 @@ func (s *statisCaculator) GetHitRate() float64 {
 	}
 	return 0
 }
+
+func (s *statisCaculator) GetBackpressureCount() uint64 {
+	return atomic.LoadUint64(&s.backpressureCount)
+}
+
+func (s *statisCaculator) fill(stats *Stats) {
+	stats.Hits = s.GetHitCount()
+	stats.Misses = s.GetMissCount()
+	stats.Sets = atomic.LoadUint64(&s.setCount)
+	stats.Deletes = atomic.LoadUint64(&s.delCount)
+	stats.Evictions.Capacity = atomic.LoadUint64(&s.evictCount[evictByCapacity])
+	stats.Evictions.WriteBuffer = atomic.LoadUint64(&s.evictCount[evictByWriteBuffer])
+	stats.Expirations = atomic.LoadUint64(&s.expireCount)
+	stats.LoadSuccesses = atomic.LoadUint64(&s.loadSuccessCount)
+	stats.LoadFailures = atomic.LoadUint64(&s.loadFailureCount)
+	stats.TotalLoadTime = time.Duration(atomic.LoadInt64(&s.loadTime))
+	for i := range s.loadLatency {
+		stats.LoadLatency[i] = atomic.LoadUint64(&s.loadLatency[i])
+	}
+	stats.SharedLoads = atomic.LoadUint64(&s.sharedLoadCount)
+	stats.DiskHits = atomic.LoadUint64(&s.diskHitCount)
+	stats.Backpressure = s.GetBackpressureCount()
+	now := time.Now().Unix()
+	stats.Last1m = s.window.sum(now, time.Minute)
+	stats.Last5m = s.window.sum(now, 5*time.Minute)
+	stats.Last15m = s.window.sum(now, 15*time.Minute)
+}
+
+// Stats is a snapshot of cache statistic.
+// Counters are counted only WithStatist(true), except Backpressure and DroppedHits.
+type Stats struct {
+	Hits          uint64
+	Misses        uint64
+	Sets          uint64
+	Deletes       uint64    // keys deleted by user
+	Evictions     Evictions // keys evicted to free space
+	Expirations   uint64    // keys deleted because expired
+	LoadSuccesses uint64
+	LoadFailures  uint64
+	TotalLoadTime time.Duration
+	LoadLatency   LoadLatency // histogram of load time
+	SharedLoads   uint64      // loads which share result of another in-flight load by singleFlight
+	DroppedHits   uint64      // hits dropped by read buffer, policy does not see them
+	Backpressure  uint64      // writes which find the write buffer full
+	DiskHits      uint64      // hits promoted from disk tier, they are counted in Hits too
+
+	// gauges, not counters
+	Entries      int   // count of keys in memory
+	Weight       int64 // total weight of keys in cache
+	PinnedWeight int64 // total weight of pinned keys
+	QueueDepth   int   // count of ops waiting in the write buffer
+	DiskEntries  int   // count of keys in disk tier
+	DiskBytes    int64 // bytes of files of disk tier
+
+	// rolling windows, hit rate and load time of the last minutes
+	Last1m  WindowStats
+	Last5m  WindowStats
+	Last15m WindowStats
+}
+
+// Evictions count keys evicted by cause
+type Evictions struct {
+	Capacity    uint64 // evicted by policy when cache is full
+	WriteBuffer uint64 // set is undone by WriteBufferDropOldest
+}
+
+// Total return count of keys evicted by all causes
+func (e Evictions) Total() uint64 {
+	return e.Capacity + e.WriteBuffer
+}
+
+// Minus return the counters increased since prev, gauges and windows keep the value of s.
+// Use it to compute per-interval deltas for dashboards.
+func (s Stats) Minus(prev Stats) Stats {
+	return Stats{
+		Hits:    s.Hits - prev.Hits,
+		Misses:  s.Misses - prev.Misses,
+		Sets:    s.Sets - prev.Sets,
+		Deletes: s.Deletes - prev.Deletes,
+		Evictions: Evictions{
+			Capacity:    s.Evictions.Capacity - prev.Evictions.Capacity,
+			WriteBuffer: s.Evictions.WriteBuffer - prev.Evictions.WriteBuffer,
+		},
+		Expirations:   s.Expirations - prev.Expirations,
+		LoadSuccesses: s.LoadSuccesses - prev.LoadSuccesses,
+		LoadFailures:  s.LoadFailures - prev.LoadFailures,
+		TotalLoadTime: s.TotalLoadTime - prev.TotalLoadTime,
+		LoadLatency:   s.LoadLatency.Minus(prev.LoadLatency),
+		SharedLoads:   s.SharedLoads - prev.SharedLoads,
+		DroppedHits:   s.DroppedHits - prev.DroppedHits,
+		Backpressure:  s.Backpressure - prev.Backpressure,
+		DiskHits:      s.DiskHits - prev.DiskHits,
+		Entries:       s.Entries,
+		Weight:        s.Weight,
+		PinnedWeight:  s.PinnedWeight,
+		QueueDepth:    s.QueueDepth,
+		DiskEntries:   s.DiskEntries,
+		DiskBytes:     s.DiskBytes,
+		Last1m:        s.Last1m,
+		Last5m:        s.Last5m,
+		Last15m:       s.Last15m,
+	}
+}
+
+// Plus return the sum of s and other, used to aggregate stats of caches
+func (s Stats) Plus(other Stats) Stats {
+	return Stats{
+		Hits:    s.Hits + other.Hits,
+		Misses:  s.Misses + other.Misses,
+		Sets:    s.Sets + other.Sets,
+		Deletes: s.Deletes + other.Deletes,
+		Evictions: Evictions{
+			Capacity:    s.Evictions.Capacity + other.Evictions.Capacity,
+			WriteBuffer: s.Evictions.WriteBuffer + other.Evictions.WriteBuffer,
+		},
+		Expirations:   s.Expirations + other.Expirations,
+		LoadSuccesses: s.LoadSuccesses + other.LoadSuccesses,
+		LoadFailures:  s.LoadFailures + other.LoadFailures,
+		TotalLoadTime: s.TotalLoadTime + other.TotalLoadTime,
+		LoadLatency:   s.LoadLatency.Plus(other.LoadLatency),
+		SharedLoads:   s.SharedLoads + other.SharedLoads,
+		DroppedHits:   s.DroppedHits + other.DroppedHits,
+		Backpressure:  s.Backpressure + other.Backpressure,
+		DiskHits:      s.DiskHits + other.DiskHits,
+		Entries:       s.Entries + other.Entries,
+		Weight:        s.Weight + other.Weight,
+		PinnedWeight:  s.PinnedWeight + other.PinnedWeight,
+		QueueDepth:    s.QueueDepth + other.QueueDepth,
+		DiskEntries:   s.DiskEntries + other.DiskEntries,
+		DiskBytes:     s.DiskBytes + other.DiskBytes,
+		Last1m:        s.Last1m.plus(other.Last1m),
+		Last5m:        s.Last5m.plus(other.Last5m),
+		Last15m:       s.Last15m.plus(other.Last15m),
+	}
+}
+
+// Minus return the counts increased since prev
+func (l LoadLatency) Minus(prev LoadLatency) LoadLatency {
+	for i := range l {
+		l[i] -= prev[i]
+	}
+	return l
+}
+
+// Plus return the sum of counts
+func (l LoadLatency) Plus(other LoadLatency) LoadLatency {
+	for i := range l {
+		l[i] += other[i]
+	}
+	return l
+}
+
+// HitRate return hits/(hits+misses)*100
+func (s Stats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total != 0 {
+		return float64(s.Hits) / float64(total) * 100
+	}
+	return 0
+}
+
+// AverageLoadTime return TotalLoadTime/(LoadSuccesses+LoadFailures)
+func (s Stats) AverageLoadTime() time.Duration {
+	if total := s.LoadSuccesses + s.LoadFailures; total != 0 {
+		return s.TotalLoadTime / time.Duration(total)
+	}
+	return 0
+}
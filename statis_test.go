@@ -0,0 +1,128 @@
+package localcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	c := NewLocalCache(WithStatist(true), WithCapacity(2))
+	defer c.Stop()
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Get("1")
+	c.Get("3")
+	c.Del("2")
+	c.GetOrLoad("4", func() (interface{}, error) { return 4, nil })
+	c.GetOrLoad("5", func() (interface{}, error) { return nil, errors.New("err") })
+	c.SetWithExpire("6", 6, -1)
+	c.Get("6")
+	time.Sleep(10 * time.Millisecond)
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 4 {
+		t.Errorf("TestStats1 hits %d misses %d", stats.Hits, stats.Misses)
+	}
+	if stats.Sets != 4 || stats.Deletes != 1 || stats.Expirations != 1 {
+		t.Errorf("TestStats2 sets %d deletes %d expirations %d", stats.Sets, stats.Deletes, stats.Expirations)
+	}
+	if stats.LoadSuccesses != 1 || stats.LoadFailures != 1 {
+		t.Errorf("TestStats3 load successes %d failures %d", stats.LoadSuccesses, stats.LoadFailures)
+	}
+	if stats.LoadLatency[0] != 2 {
+		t.Errorf("TestStats3 load latency %v", stats.LoadLatency)
+	}
+	if stats.Entries != 2 || stats.Weight != 2 {
+		t.Errorf("TestStats4 entries %d weight %d", stats.Entries, stats.Weight)
+	}
+	c.SetWithOptions("7", 7, Options{Pinned: true})
+	time.Sleep(10 * time.Millisecond)
+	delta := c.Stats().Minus(stats)
+	if delta.Sets != 1 || delta.Evictions.Capacity != 1 || delta.Hits != 0 || delta.Entries != 2 {
+		t.Errorf("TestStats5 delta %+v", delta)
+	}
+	// gauges are kept by Minus
+	if delta.Weight != 2 || delta.PinnedWeight != 1 {
+		t.Errorf("TestStats6 delta weight %d pinned weight %d", delta.Weight, delta.PinnedWeight)
+	}
+}
+
+func TestWeigher(t *testing.T) {
+	c := NewLocalCache(WithCapacity(10), WithWeigher(func(key string, value interface{}) int64 {
+		return int64(len(value.(string)))
+	}))
+	defer c.Stop()
+	c.Set("1", "aaaa")
+	c.Set("2", "bbbb")
+	time.Sleep(10 * time.Millisecond)
+	// weight 4+4+4 > 10, evict 1
+	c.Set("3", "cccc")
+	time.Sleep(10 * time.Millisecond)
+	if _, has := c.Get("1"); has {
+		t.Error("TestWeigher1 1 exists")
+	}
+	if w := c.Stats().Weight; w != 8 {
+		t.Errorf("TestWeigher2 weight %d <> 8", w)
+	}
+	// weight of 3 change to 2
+	c.Set("3", "cc")
+	time.Sleep(10 * time.Millisecond)
+	if w := c.Stats().Weight; w != 6 {
+		t.Errorf("TestWeigher3 weight %d <> 6", w)
+	}
+	if v, _ := c.Get("3"); v.(string) != "cc" {
+		t.Errorf("TestWeigher4 3 = %v", v)
+	}
+}
+
+func TestTopKeys(t *testing.T) {
+	c := NewLocalCache(WithHotKeys(2))
+	defer c.Stop()
+	c.Set("a", 1)
+	c.Set("b", 1)
+	c.Set("c", 1)
+	for i := 0; i < 30; i++ {
+		c.Get("a")
+		time.Sleep(100 * time.Microsecond)
+		if i%2 == 0 {
+			c.Get("b")
+		}
+		if i%10 == 0 {
+			c.Get("c")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	keys := c.TopKeys(5)
+	if len(keys) != 2 || keys[0].Key != "a" || keys[1].Key != "b" {
+		t.Errorf("TestTopKeys %+v", keys)
+	}
+	// deleted keys are not reported
+	c.Del("a")
+	if keys := c.TopKeys(5); len(keys) != 1 || keys[0].Key != "b" {
+		t.Errorf("TestTopKeys del %+v", keys)
+	}
+	c.Set("d", 1)
+	c.Get("d")
+	c.DelPrefix("d")
+	time.Sleep(10 * time.Millisecond)
+	for _, kc := range c.TopKeys(5) {
+		if kc.Key == "d" {
+			t.Errorf("TestTopKeys del prefix %+v", kc)
+		}
+	}
+	c.Flush()
+	if keys := c.TopKeys(5); len(keys) != 0 {
+		t.Errorf("TestTopKeys flush %+v", keys)
+	}
+	a := NewArenaCache(1<<16, WithHotKeys(2))
+	defer a.Stop()
+	a.Set("a", []byte("1"))
+	a.Get("a")
+	a.Del("a")
+	if keys := a.TopKeys(5); len(keys) != 0 {
+		t.Errorf("TestTopKeys arena del %+v", keys)
+	}
+	if NewLocalCache().TopKeys(1) != nil {
+		t.Error("TestTopKeys not enable")
+	}
+}
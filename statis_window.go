@@ -0,0 +1,106 @@
+package localcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const windowBucketCnt = 15 * 60 // keep the last 15 minutes, a bucket per second
+
+// statisWindow is a ring of per-second buckets, to caculate statist of the last minutes.
+// A bucket is reset when a new second reuses it, counts may lose a little at that moment.
+type statisWindow struct {
+	buckets [windowBucketCnt]windowBucket
+}
+
+type windowBucket struct {
+	second   int64 // unix second of the counts
+	hits     uint64
+	misses   uint64
+	loads    uint64
+	loadTime int64 // nanoseconds
+}
+
+// bucket return the bucket of second now, reset it if it is used by an old second
+func (w *statisWindow) bucket(now int64) *windowBucket {
+	b := &w.buckets[now%windowBucketCnt]
+	if second := atomic.LoadInt64(&b.second); second != now &&
+		atomic.CompareAndSwapInt64(&b.second, second, now) {
+		atomic.StoreUint64(&b.hits, 0)
+		atomic.StoreUint64(&b.misses, 0)
+		atomic.StoreUint64(&b.loads, 0)
+		atomic.StoreInt64(&b.loadTime, 0)
+	}
+	return b
+}
+
+func (w *statisWindow) hitIncr() {
+	atomic.AddUint64(&w.bucket(time.Now().Unix()).hits, 1)
+}
+
+func (w *statisWindow) missIncr() {
+	atomic.AddUint64(&w.bucket(time.Now().Unix()).misses, 1)
+}
+
+func (w *statisWindow) loadIncr(cost time.Duration) {
+	b := w.bucket(time.Now().Unix())
+	atomic.AddUint64(&b.loads, 1)
+	atomic.AddInt64(&b.loadTime, int64(cost))
+}
+
+// sum return the statist of the last window, include the current second
+func (w *statisWindow) sum(now int64, window time.Duration) WindowStats {
+	stats := WindowStats{Window: window}
+	seconds := int64(window / time.Second)
+	if seconds > windowBucketCnt {
+		seconds = windowBucketCnt
+	}
+	for second := now - seconds + 1; second <= now; second++ {
+		b := &w.buckets[second%windowBucketCnt]
+		if atomic.LoadInt64(&b.second) != second {
+			continue
+		}
+		stats.Hits += atomic.LoadUint64(&b.hits)
+		stats.Misses += atomic.LoadUint64(&b.misses)
+		stats.Loads += atomic.LoadUint64(&b.loads)
+		stats.LoadTime += time.Duration(atomic.LoadInt64(&b.loadTime))
+	}
+	return stats
+}
+
+// WindowStats is the statist of the last window of time
+type WindowStats struct {
+	Window   time.Duration
+	Hits     uint64
+	Misses   uint64
+	Loads    uint64
+	LoadTime time.Duration
+}
+
+// plus return the sum of w and other of the same window
+func (w WindowStats) plus(other WindowStats) WindowStats {
+	if w.Window == 0 {
+		w.Window = other.Window
+	}
+	w.Hits += other.Hits
+	w.Misses += other.Misses
+	w.Loads += other.Loads
+	w.LoadTime += other.LoadTime
+	return w
+}
+
+// HitRate return hits/(hits+misses)*100 in the window
+func (w WindowStats) HitRate() float64 {
+	if total := w.Hits + w.Misses; total != 0 {
+		return float64(w.Hits) / float64(total) * 100
+	}
+	return 0
+}
+
+// AverageLoadTime return LoadTime/Loads in the window
+func (w WindowStats) AverageLoadTime() time.Duration {
+	if w.Loads != 0 {
+		return w.LoadTime / time.Duration(w.Loads)
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package localcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatisWindow(t *testing.T) {
+	var w statisWindow
+	now := time.Now().Unix()
+	// 10 minutes ago
+	old := w.bucket(now - 600)
+	old.hits, old.misses = 10, 10
+	// 2 minutes ago
+	w.bucket(now - 120).misses = 10
+	cur := w.bucket(now)
+	cur.hits, cur.loads, cur.loadTime = 10, 2, int64(4*time.Millisecond)
+
+	if s := w.sum(now, time.Minute); s.Hits != 10 || s.Misses != 0 || s.HitRate() != 100 || s.AverageLoadTime() != 2*time.Millisecond {
+		t.Errorf("TestStatisWindow1 1m %+v", s)
+	}
+	if s := w.sum(now, 5*time.Minute); s.HitRate() != 50 {
+		t.Errorf("TestStatisWindow2 5m %+v", s)
+	}
+	if s := w.sum(now, 15*time.Minute); s.Hits != 20 || s.Misses != 20 {
+		t.Errorf("TestStatisWindow3 15m %+v", s)
+	}
+	// the bucket is reused 15 minutes later
+	if b := w.bucket(now + windowBucketCnt); b.hits != 0 {
+		t.Errorf("TestStatisWindow4 bucket not reset %+v", b)
+	}
+}
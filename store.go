@@ -0,0 +1,220 @@
+package localcache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// WriteThrough write Set and Del to backing store before cache is changed
+	WriteThrough = "write_through"
+	// WriteBehind change cache at once and write Set and Del to backing store in background
+	WriteBehind = "write_behind"
+)
+
+// Store is the backing storage of cache, misses read through it and writes propagate to it
+type Store interface {
+	// Get return the value of key and if the key exists
+	Get(key string) (interface{}, bool, error)
+	// Set a key-value
+	Set(key string, value interface{}) error
+	// Delete a key, delete a key not exists is not an error
+	Delete(key string) error
+	// GetMulti return values of keys exist
+	GetMulti(keys []string) (map[string]interface{}, error)
+}
+
+// GetMulti get keys and return values of keys exist, misses read through backing store by one GetMulti
+func (l *localCache) GetMulti(keys []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(keys))
+	if l.isClosed() {
+		return values
+	}
+	var misses []string
+	for _, key := range keys {
+		// read memory and disk tier first, then read misses through store together
+		if value, has := l.getLocal(key); has {
+			values[key] = value
+			l.statist.hitIncr()
+		} else {
+			misses = append(misses, key)
+			l.statist.missIncr()
+		}
+	}
+	if l.writeBehindQueue != nil {
+		misses = l.readDirty(misses, values)
+	}
+	if len(misses) == 0 || l.store == nil {
+		return values
+	}
+	start := time.Now()
+	found, err := l.store.GetMulti(misses)
+	l.statist.loadIncr(time.Since(start), err)
+	if err != nil {
+		l.onError(err)
+	}
+	for key, value := range found {
+		if l.writeBehindQueue != nil && l.writeBehindQueue.isDirty(key) {
+			// set or deleted while reading store, the value read is stale
+			continue
+		}
+		l.setWithTags(key, value, l.ttl)
+		values[key] = value
+	}
+	return values
+}
+
+// readDirty answer keys from the write-behind queue and set them to cache, return keys not in queue.
+// Keys with a pending delete are not found.
+func (l *localCache) readDirty(keys []string, values map[string]interface{}) []string {
+	clean := keys[:0]
+	for _, key := range keys {
+		op, has := l.writeBehindQueue.get(key)
+		if !has {
+			clean = append(clean, key)
+			continue
+		}
+		if !op.Delete {
+			l.setWithTags(key, op.Value, l.ttl)
+			values[key] = op.Value
+		}
+	}
+	return clean
+}
+
+// readThrough get key from backing store and set it to cache, concurrent reads of a key share one store Get
+func (l *localCache) readThrough(key string) (interface{}, bool) {
+	type result struct {
+		value interface{}
+		has   bool
+	}
+	// the dirty value is newer than store
+	if l.writeBehindQueue != nil {
+		if op, has := l.writeBehindQueue.get(key); has {
+			if op.Delete {
+				return nil, false
+			}
+			l.setWithTags(key, op.Value, l.ttl)
+			return op.Value, true
+		}
+	}
+	res, err, shared := l.storeGroup.DoShared(key, func() (interface{}, error) {
+		start := time.Now()
+		value, has, err := l.store.Get(key)
+		l.statist.loadIncr(time.Since(start), err)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			l.setWithTags(key, value, l.ttl)
+		}
+		return result{value: value, has: has}, nil
+	})
+	if shared {
+		l.statist.sharedLoadIncr()
+	}
+	if err != nil {
+		l.onError(err)
+		return nil, false
+	}
+	r := res.(result)
+	return r.value, r.has
+}
+
+// writeStore write key-value to backing store, return false if write through failed.
+// The key is deleted from cache when write through failed, so cache is not newer than store.
+func (l *localCache) writeStore(key string, value interface{}) bool {
+	if !l.storeSet(key, value) {
+		l.delete(key)
+		return false
+	}
+	return true
+}
+
+// storeSet write key-value to backing store or write-behind queue, return false if write through failed
+func (l *localCache) storeSet(key string, value interface{}) bool {
+	if l.storeWriteMode == WriteBehind {
+		l.writeBehind(WriteOp{Key: key, Value: value})
+		return true
+	}
+	if err := l.store.Set(key, value); err != nil {
+		l.onError(err)
+		return false
+	}
+	return true
+}
+
+// deleteStore delete key from backing store
+func (l *localCache) deleteStore(key string) {
+	if l.storeWriteMode == WriteBehind {
+		l.writeBehind(WriteOp{Key: key, Delete: true})
+		return
+	}
+	if err := l.store.Delete(key); err != nil {
+		l.onError(err)
+	}
+}
+
+// MapStore is a Store keeps key-values in a map, it is the reference implementation and a test double
+type MapStore struct {
+	lock sync.RWMutex
+	data map[string]interface{}
+}
+
+// NewMapStore return an empty MapStore
+func NewMapStore() *MapStore {
+	return &MapStore{data: make(map[string]interface{})}
+}
+
+func (m *MapStore) Get(key string) (interface{}, bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	value, has := m.data[key]
+	return value, has, nil
+}
+
+func (m *MapStore) Set(key string, value interface{}) error {
+	m.lock.Lock()
+	m.data[key] = value
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *MapStore) Delete(key string) error {
+	m.lock.Lock()
+	delete(m.data, key)
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *MapStore) GetMulti(keys []string) (map[string]interface{}, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if value, has := m.data[key]; has {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+func (m *MapStore) WriteBatch(ops []WriteOp) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, op := range ops {
+		if op.Delete {
+			delete(m.data, op.Key)
+		} else {
+			m.data[op.Key] = op.Value
+		}
+	}
+	return nil
+}
+
+// Len return count of keys
+func (m *MapStore) Len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.data)
+}
@@ -0,0 +1,122 @@
+package localcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// errStore fail all writes
+type errStore struct {
+	*MapStore
+}
+
+func (errStore) Set(key string, value interface{}) error {
+	return errors.New("set failed")
+}
+
+func TestBackingStoreWriteThrough(t *testing.T) {
+	store := NewMapStore()
+	store.Set("a", 1)
+	c := NewLocalCache(WithStatist(true), WithBackingStore(store, WriteThrough))
+	defer c.Stop()
+	// read through
+	if v, has := c.Get("a"); !has || v != 1 {
+		t.Errorf("TestBackingStoreWriteThrough1 get a = %v, %v", v, has)
+	}
+	if stats := c.Stats(); stats.LoadSuccesses != 1 || stats.Misses != 1 {
+		t.Errorf("TestBackingStoreWriteThrough2 loads %d misses %d", stats.LoadSuccesses, stats.Misses)
+	}
+	store.Set("a", 2)
+	if v, _ := c.Get("a"); v != 1 {
+		t.Errorf("TestBackingStoreWriteThrough3 a read from store again, %v", v)
+	}
+	// write through
+	c.Set("b", 3)
+	if v, has, _ := store.Get("b"); !has || v != 3 {
+		t.Errorf("TestBackingStoreWriteThrough4 store b = %v, %v", v, has)
+	}
+	c.Del("b")
+	if _, has, _ := store.Get("b"); has {
+		t.Error("TestBackingStoreWriteThrough5 b not deleted from store")
+	}
+	// InvalidateTag only change cache
+	c.SetWithTags("t", 4, 10, "tag")
+	c.InvalidateTag("tag")
+	if _, has, _ := store.Get("t"); !has {
+		t.Error("TestBackingStoreWriteThrough6 t deleted from store by InvalidateTag")
+	}
+	// DelPrefix and DelMatch only change cache too
+	c.Set("tenant:1:a", 6)
+	c.Set("tenant:1:b", 7)
+	if c.DelPrefix("tenant:1:a") != 1 || c.DelMatch("tenant:*:b") != 1 {
+		t.Error("TestBackingStoreWriteThrough9 keys not deleted from cache")
+	}
+	if _, has, _ := store.Get("tenant:1:a"); !has {
+		t.Error("TestBackingStoreWriteThrough10 tenant:1:a deleted from store by DelPrefix")
+	}
+	if _, has, _ := store.Get("tenant:1:b"); !has {
+		t.Error("TestBackingStoreWriteThrough11 tenant:1:b deleted from store by DelMatch")
+	}
+	// read through by one GetMulti
+	store.Set("c", 5)
+	values := c.GetMulti([]string{"a", "c", "d"})
+	if len(values) != 2 || values["a"] != 1 || values["c"] != 5 {
+		t.Errorf("TestBackingStoreWriteThrough7 get multi %v", values)
+	}
+	if _, has := c.Get("missing"); has {
+		t.Error("TestBackingStoreWriteThrough8 get missing key")
+	}
+}
+
+func TestBackingStoreWriteThroughFail(t *testing.T) {
+	var errs []error
+	c := NewLocalCache(WithBackingStore(errStore{NewMapStore()}, WriteThrough),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }))
+	defer c.Stop()
+	c.Set("a", 1)
+	if _, has := c.Get("a"); has || len(errs) != 1 {
+		t.Errorf("TestBackingStoreWriteThroughFail a cached when write failed, errs %v", errs)
+	}
+}
+
+func TestBackingStoreWriteBehind(t *testing.T) {
+	store := NewMapStore()
+	c := NewLocalCache(WithBackingStore(store, WriteBehind), WithWriteBehind(WriteBehindConfig{FlushInterval: 5 * time.Millisecond}))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Del("b")
+	if v, has := c.Get("a"); !has || v != 1 {
+		t.Errorf("TestBackingStoreWriteBehind1 get a = %v, %v", v, has)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if v, has, _ := store.Get("a"); !has || v != 1 {
+		t.Errorf("TestBackingStoreWriteBehind2 store a = %v, %v", v, has)
+	}
+	c.Set("c", 3)
+	// ops left are written when close
+	c.Stop()
+	if store.Len() != 2 {
+		t.Errorf("TestBackingStoreWriteBehind3 store len %d <> 2", store.Len())
+	}
+}
+
+func TestBackingStoreWriteBehindGetMulti(t *testing.T) {
+	store := NewMapStore()
+	store.Set("k", "old")
+	store.Set("j", "old")
+	c := NewLocalCache(WithBackingStore(store, WriteBehind), WithWriteBehind(WriteBehindConfig{FlushInterval: time.Hour}))
+	defer c.Stop()
+	c.Set("k", "new")
+	c.Del("k")
+	c.Set("j", "new")
+	c.Invalidate("j")
+	// pending ops are newer than store
+	values := c.GetMulti([]string{"k", "j"})
+	if _, has := values["k"]; has || values["j"] != "new" {
+		t.Errorf("TestBackingStoreWriteBehindGetMulti1 get multi %v", values)
+	}
+	if v, has := c.Get("k"); has {
+		t.Errorf("TestBackingStoreWriteBehindGetMulti2 deleted k cached again %v", v)
+	}
+}
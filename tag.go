@@ -0,0 +1,66 @@
+package localcache
+
+import "sync"
+
+// tagIndex keep the keys of every tag, so we can invalidate a group of keys by tag
+type tagIndex struct {
+	lock sync.RWMutex
+	tags map[string]map[string]struct{} // tag -> keys
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{tags: make(map[string]map[string]struct{})}
+}
+
+// add key to every tag
+func (t *tagIndex) add(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	t.lock.Lock()
+	for _, tag := range tags {
+		keys, has := t.tags[tag]
+		if !has {
+			keys = make(map[string]struct{})
+			t.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	t.lock.Unlock()
+}
+
+// remove key from every tag, and del the tag which has no keys
+func (t *tagIndex) remove(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	t.lock.Lock()
+	for _, tag := range tags {
+		keys, has := t.tags[tag]
+		if !has {
+			continue
+		}
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(t.tags, tag)
+		}
+	}
+	t.lock.Unlock()
+}
+
+// keys return all keys of tag
+func (t *tagIndex) keys(tag string) []string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	keys := make([]string, 0, len(t.tags[tag]))
+	for key := range t.tags[tag] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (t *tagIndex) flush() {
+	t.lock.Lock()
+	t.tags = make(map[string]map[string]struct{})
+	t.lock.Unlock()
+}
@@ -0,0 +1,53 @@
+package localcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	c := NewLocalCache()
+	defer c.Stop()
+	c.SetWithTags("p1", 1, 60, "price", "stock")
+	c.SetWithTags("p2", 2, 60, "stock")
+	c.SetWithTags("p3", 3, 60, "category")
+	time.Sleep(10 * time.Millisecond)
+	if n := c.InvalidateTag("stock"); n != 2 {
+		t.Errorf("TestInvalidateTag1 deleted %d <> 2", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, has := c.Get("p1"); has {
+		t.Error("TestInvalidateTag2 p1 exists")
+	}
+	if _, has := c.Get("p3"); !has {
+		t.Error("TestInvalidateTag3 p3 not exists")
+	}
+	// p1 was deleted, so tag price has no keys
+	if n := c.InvalidateTag("price"); n != 0 {
+		t.Errorf("TestInvalidateTag4 deleted %d <> 0", n)
+	}
+	// set again without tags replace the tags
+	c.SetWithTags("p3", 3, 60)
+	if n := c.InvalidateTag("category"); n != 0 {
+		t.Errorf("TestInvalidateTag5 deleted %d <> 0", n)
+	}
+}
+
+func TestTagIndexClean(t *testing.T) {
+	c := NewLocalCache(WithCapacity(1))
+	defer c.Stop()
+	index := c.(*localCache).tagIndex
+	c.SetWithTags("1", 1, 60, "a")
+	time.Sleep(10 * time.Millisecond)
+	// evict key 1
+	c.SetWithTags("2", 2, 0, "b")
+	time.Sleep(10 * time.Millisecond)
+	if keys := index.keys("a"); len(keys) != 0 {
+		t.Errorf("TestTagIndexClean1 tag a has keys %v after evict", keys)
+	}
+	// wait key 2 expired and deleted by ttlProcess
+	time.Sleep(1200 * time.Millisecond)
+	if keys := index.keys("b"); len(keys) != 0 {
+		t.Errorf("TestTagIndexClean2 tag b has keys %v after expire", keys)
+	}
+}
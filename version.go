@@ -0,0 +1,75 @@
+package localcache
+
+import "time"
+
+// maxVersionReads is how many times GetWithVersion reads again when the key is set while it reads
+const maxVersionReads = 3
+
+// GetWithVersion get a key like Get and return the version of the value.
+// Version 0 means the key is set again while reading, a CompareAndSwap with it always fails.
+func (l *localCache) GetWithVersion(key string) (interface{}, uint64, bool) {
+	for i := 1; ; i++ {
+		// versions only grow, so the value is of version if no set between the two reads
+		version := l.versionOf(key)
+		value, has := l.Get(key)
+		if !has {
+			return nil, 0, false
+		}
+		if version != 0 && version == l.versionOf(key) {
+			return value, version, true
+		}
+		if i == maxVersionReads {
+			return value, 0, true
+		}
+	}
+}
+
+// CompareAndSwap set a key-value and replace the tags of key only if the version of key is still version,
+// write it to backing store if need
+func (l *localCache) CompareAndSwap(key string, value interface{}, ttl int64, version uint64) bool {
+	if l.isClosed() || version == 0 {
+		return false
+	}
+	data := value
+	if l.compression != nil {
+		var err error
+		if data, err = l.encodeValue(value); err != nil {
+			l.onError(err)
+			return false
+		}
+	}
+	expireTime := time.Now().Add(time.Duration(ttl) * time.Second).Unix()
+	weight := l.weigh(key, data)
+	l.keyLock.Lock(key)
+	if l.versionOf(key) != version {
+		l.keyLock.Unlock(key)
+		return false
+	}
+	// keep priority and pinned of the key
+	obj, _ := l.dict.Get(key)
+	meta := l.policy.unpack(obj).entryMeta
+	if l.store != nil && !l.storeSet(key, value) {
+		l.keyLock.Unlock(key)
+		// cache is not newer than store
+		l.delete(key)
+		return false
+	}
+	l.statist.setIncr()
+	l.setLocked(key, data, weight, expireTime, nil, meta)
+	return true
+}
+
+// versionOf return the version of key in memory, 0 if not exists or expired
+func (l *localCache) versionOf(key string) uint64 {
+	obj, has := l.dict.Get(key)
+	if !has {
+		return 0
+	}
+	element := l.policy.unpack(obj)
+	element.lock.RLock()
+	defer element.lock.RUnlock()
+	if element.isExpire() {
+		return 0
+	}
+	return element.version
+}
@@ -0,0 +1,64 @@
+package localcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	caches := map[string]Cache{
+		"local": NewLocalCache(WithStatist(true)),
+		"arena": NewArenaCache(1 << 20),
+	}
+	for name, c := range caches {
+		c.Set("a", []byte("1"))
+		v, version, has := c.GetWithVersion("a")
+		if !has || string(v.([]byte)) != "1" || version == 0 {
+			t.Errorf("TestCompareAndSwap1 %s get a = %v, %d, %v", name, v, version, has)
+		}
+		if !c.CompareAndSwap("a", []byte("2"), 10, version) {
+			t.Errorf("TestCompareAndSwap2 %s swap a failed", name)
+		}
+		// version changed by the swap
+		if c.CompareAndSwap("a", []byte("3"), 10, version) {
+			t.Errorf("TestCompareAndSwap3 %s swap a with old version", name)
+		}
+		_, version2, _ := c.GetWithVersion("a")
+		c.Set("a", []byte("4"))
+		if version2 <= version || c.CompareAndSwap("a", []byte("5"), 10, version2) {
+			t.Errorf("TestCompareAndSwap4 %s swap a after set, versions %d %d", name, version, version2)
+		}
+		if v, _ := c.Get("a"); string(v.([]byte)) != "4" {
+			t.Errorf("TestCompareAndSwap5 %s a = %s", name, v)
+		}
+		if _, _, has := c.GetWithVersion("b"); has || c.CompareAndSwap("b", []byte("1"), 10, 0) {
+			t.Errorf("TestCompareAndSwap6 %s swap b not exists", name)
+		}
+		c.Stop()
+	}
+}
+
+func TestTouch(t *testing.T) {
+	caches := map[string]Cache{
+		"local": NewLocalCache(WithGlobalTTL(10)),
+		"arena": NewArenaCache(1<<20, WithGlobalTTL(10)),
+	}
+	for name, c := range caches {
+		c.Set("a", []byte("1"))
+		_, version, _ := c.GetWithVersion("a")
+		if !c.Touch("a", 100) {
+			t.Errorf("TestTouch1 %s touch a failed", name)
+		}
+		if ttl, _ := c.TTL("a"); ttl <= 90*time.Second {
+			t.Errorf("TestTouch2 %s ttl of a %v", name, ttl)
+		}
+		// value and version are kept
+		if v, version2, _ := c.GetWithVersion("a"); string(v.([]byte)) != "1" || version2 != version {
+			t.Errorf("TestTouch3 %s a = %s, version %d <> %d", name, v, version2, version)
+		}
+		if c.Touch("b", 100) {
+			t.Errorf("TestTouch4 %s touch b not exists", name)
+		}
+		c.Stop()
+	}
+}
@@ -0,0 +1,282 @@
+package localcache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultWriteBehindBatchSize     = 100
+	defaultWriteBehindFlushInterval = time.Second
+	defaultWriteBehindMaxRetries    = 3
+	defaultWriteBehindRetryBackoff  = 100 * time.Millisecond
+)
+
+// WriteOp is a set or delete of key to write to backing store
+type WriteOp struct {
+	Key    string
+	Value  interface{} // nil if Delete
+	Delete bool
+}
+
+// BatchStore is a Store which writes a batch of ops at once, write-behind use it if the store implements it
+type BatchStore interface {
+	Store
+	// WriteBatch write ops in order
+	WriteBatch(ops []WriteOp) error
+}
+
+// WriteBehindConfig configure how write-behind flushes dirty keys to backing store
+type WriteBehindConfig struct {
+	// BatchSize flush when so many keys are dirty, it is the max size of a batch too. default 100
+	BatchSize int
+	// FlushInterval flush all dirty keys every interval, default 1s
+	FlushInterval time.Duration
+	// MaxRetries retry a failed batch, default 3, negative means no retry
+	MaxRetries int
+	// RetryBackoff wait before the first retry, it doubles every retry. default 100ms
+	RetryBackoff time.Duration
+	// DeadLetter is called with the batch still failed after retries, default pass err to the error handler
+	DeadLetter func(ops []WriteOp, err error)
+}
+
+// WithWriteBehind configure the write-behind queue of WithBackingStore(store, WriteBehind).
+// Set and Del change cache at once and mark the key dirty, writes of a dirty key are coalesced to the last one.
+// Dirty keys are not evicted until they are written.
+func WithWriteBehind(config WriteBehindConfig) Option {
+	return func(c *localCache) {
+		c.writeBehindConfig = config
+	}
+}
+
+// writeBehindQueue keep the last op of every dirty key by the order they became dirty
+type writeBehindQueue struct {
+	lock     sync.Mutex
+	dirty    map[string]*WriteOp
+	order    []string            // dirty keys, a key keeps its place when it is written again
+	inflight map[string]*WriteOp // ops being written, still dirty until written
+	signal   chan struct{}       // notify when batchSize keys are dirty
+
+	batchSize int
+}
+
+func newWriteBehindQueue(batchSize int) *writeBehindQueue {
+	return &writeBehindQueue{
+		dirty:     make(map[string]*WriteOp),
+		inflight:  make(map[string]*WriteOp),
+		signal:    make(chan struct{}, 1),
+		batchSize: batchSize,
+	}
+}
+
+// add op, replace the op of the same key not written yet
+func (q *writeBehindQueue) add(op WriteOp) {
+	q.lock.Lock()
+	if _, has := q.dirty[op.Key]; !has {
+		q.order = append(q.order, op.Key)
+	}
+	q.dirty[op.Key] = &op
+	full := len(q.dirty) >= q.batchSize
+	q.lock.Unlock()
+	if full {
+		select {
+		case q.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take at most batchSize oldest ops and mark them inflight, return nil if none or less than min
+func (q *writeBehindQueue) take(min int) []*WriteOp {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.dirty) == 0 || len(q.dirty) < min {
+		return nil
+	}
+	n := len(q.order)
+	if n > q.batchSize {
+		n = q.batchSize
+	}
+	ops := make([]*WriteOp, n)
+	for i, key := range q.order[:n] {
+		ops[i] = q.dirty[key]
+		q.inflight[key] = ops[i]
+		delete(q.dirty, key)
+	}
+	q.order = q.order[n:]
+	return ops
+}
+
+// done remove ops from inflight, an op replaced by a newer inflight op is kept
+func (q *writeBehindQueue) done(ops []*WriteOp) {
+	q.lock.Lock()
+	for _, op := range ops {
+		if q.inflight[op.Key] == op {
+			delete(q.inflight, op.Key)
+		}
+	}
+	q.lock.Unlock()
+}
+
+// get return the newest op of key not written yet
+func (q *writeBehindQueue) get(key string) (*WriteOp, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if op, has := q.dirty[key]; has {
+		return op, true
+	}
+	op, has := q.inflight[key]
+	return op, has
+}
+
+// isDirty return whether key has an op not written yet
+func (q *writeBehindQueue) isDirty(key string) bool {
+	_, has := q.get(key)
+	return has
+}
+
+// writeBehind add op to queue, ops after closed are dropped
+func (l *localCache) writeBehind(op WriteOp) {
+	l.closeLock.RLock()
+	defer l.closeLock.RUnlock()
+	if l.isClosed() {
+		return
+	}
+	l.writeBehindQueue.add(op)
+}
+
+// canEvict return false if key of obj is dirty
+func (l *localCache) canEvict(obj interface{}) bool {
+	if l.writeBehindQueue == nil {
+		return true
+	}
+	return !l.writeBehindQueue.isDirty(l.policy.unpack(obj).key)
+}
+
+// writeBehindProcess run a loop to flush dirty keys on batch size or interval, flush all when stop
+func (l *localCache) writeBehindProcess() {
+	defer l.wg.Done()
+	t := time.NewTicker(l.writeBehindConfig.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.writeBehindQueue.signal:
+			l.flushDirty(l.writeBehindConfig.BatchSize)
+		case <-t.C:
+			l.flushDirty(0)
+		case <-l.stopChan:
+			// no one add after stop, flush all left
+			l.flushDirty(0)
+			return
+		}
+	}
+}
+
+// flushDirty write batches until less than min keys are dirty
+func (l *localCache) flushDirty(min int) {
+	for {
+		ops := l.writeBehindQueue.take(min)
+		if ops == nil {
+			return
+		}
+		ok := l.writeBatch(ops)
+		l.writeBehindQueue.done(ops)
+		if ok {
+			l.fitWritten()
+		}
+	}
+}
+
+// fitWritten evict keys skipped while they were dirty, if cache is over capacity after a batch is written
+func (l *localCache) fitWritten() {
+	l.policyLock.Lock()
+	l.policy.fit()
+	for _, ns := range l.namespaces.list() {
+		if ns.policy != nil {
+			ns.policy.fit()
+		}
+	}
+	l.fitCapacity(l.policy)
+	l.policyLock.Unlock()
+	// a shard policy is guarded by the keyLock of its shard
+	for i, p := range l.shardPolicies {
+		l.keyLock.LockIndex(uint32(i))
+		p.fit()
+		l.keyLock.UnlockIndex(uint32(i))
+	}
+}
+
+// writeBatch write ops to store, retry with backoff and call DeadLetter if still failed, return if written.
+// The backoff is not waited after stop, the failed batch is passed to DeadLetter at once.
+func (l *localCache) writeBatch(ops []*WriteOp) bool {
+	batch := make([]WriteOp, len(ops))
+	for i, op := range ops {
+		batch[i] = *op
+	}
+	backoff := l.writeBehindConfig.RetryBackoff
+	var err error
+	for i := 0; ; i++ {
+		if err = l.applyBatch(batch); err == nil {
+			return true
+		}
+		if i >= l.writeBehindConfig.MaxRetries || !l.waitBackoff(backoff) {
+			break
+		}
+		backoff *= 2
+	}
+	if l.writeBehindConfig.DeadLetter != nil {
+		l.writeBehindConfig.DeadLetter(batch, err)
+	} else {
+		l.onError(err)
+	}
+	return false
+}
+
+// waitBackoff wait d before retry, return false if cache is stopped while waiting
+func (l *localCache) waitBackoff(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-l.stopChan:
+		return false
+	}
+}
+
+// applyBatch write ops by WriteBatch if store implements BatchStore, else one by one
+func (l *localCache) applyBatch(ops []WriteOp) error {
+	if store, ok := l.store.(BatchStore); ok {
+		return store.WriteBatch(ops)
+	}
+	for _, op := range ops {
+		var err error
+		if op.Delete {
+			err = l.store.Delete(op.Key)
+		} else {
+			err = l.store.Set(op.Key, op.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDefault set default values of config not set
+func (c *WriteBehindConfig) setDefault() {
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultWriteBehindBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = defaultWriteBehindFlushInterval
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	} else if c.MaxRetries == 0 {
+		c.MaxRetries = defaultWriteBehindMaxRetries
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultWriteBehindRetryBackoff
+	}
+}
@@ -0,0 +1,145 @@
+package localcache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countStore count batches and fail the first failures writes
+type countStore struct {
+	*MapStore
+	lock     sync.Mutex
+	batches  [][]WriteOp
+	failures int
+}
+
+func (s *countStore) WriteBatch(ops []WriteOp) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("write failed")
+	}
+	s.batches = append(s.batches, ops)
+	return s.MapStore.WriteBatch(ops)
+}
+
+func (s *countStore) batchCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.batches)
+}
+
+func TestWriteBehindCoalesce(t *testing.T) {
+	store := &countStore{MapStore: NewMapStore()}
+	c := NewLocalCache(WithBackingStore(store, WriteBehind), WithWriteBehind(WriteBehindConfig{BatchSize: 3, FlushInterval: time.Hour}))
+	for i := 0; i < 10; i++ {
+		c.Set("a", i)
+	}
+	c.Set("b", 1)
+	time.Sleep(10 * time.Millisecond)
+	if store.batchCount() != 0 {
+		t.Errorf("TestWriteBehindCoalesce1 %d batches before batch size", store.batchCount())
+	}
+	// the third dirty key trigger a batch
+	c.Set("c", 1)
+	time.Sleep(10 * time.Millisecond)
+	if store.batchCount() != 1 || len(store.batches[0]) != 3 {
+		t.Fatalf("TestWriteBehindCoalesce2 batches %v", store.batches)
+	}
+	if v, _, _ := store.Get("a"); v != 9 {
+		t.Errorf("TestWriteBehindCoalesce3 store a = %v", v)
+	}
+	c.Del("b")
+	c.Stop()
+	if _, has, _ := store.Get("b"); has || store.batchCount() != 2 {
+		t.Errorf("TestWriteBehindCoalesce4 b not deleted when close, batches %d", store.batchCount())
+	}
+}
+
+func TestWriteBehindRetry(t *testing.T) {
+	store := &countStore{MapStore: NewMapStore(), failures: 2}
+	var deadOps []WriteOp
+	c := NewLocalCache(WithBackingStore(store, WriteBehind), WithWriteBehind(WriteBehindConfig{
+		FlushInterval: time.Millisecond,
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+		DeadLetter:    func(ops []WriteOp, err error) { deadOps = append(deadOps, ops...) },
+	}))
+	c.Set("a", 1)
+	time.Sleep(20 * time.Millisecond)
+	if v, _, _ := store.Get("a"); v != 1 {
+		t.Errorf("TestWriteBehindRetry1 store a = %v after retry", v)
+	}
+	store.lock.Lock()
+	store.failures = 3
+	store.lock.Unlock()
+	c.Set("b", 2)
+	c.Stop()
+	if len(deadOps) != 1 || deadOps[0].Key != "b" {
+		t.Errorf("TestWriteBehindRetry2 dead ops %v", deadOps)
+	}
+}
+
+func TestWriteBehindNotEvictDirty(t *testing.T) {
+	store := &countStore{MapStore: NewMapStore()}
+	c := NewLocalCache(WithCapacity(2), WithBackingStore(store, WriteBehind), WithWriteBehind(WriteBehindConfig{FlushInterval: time.Hour}))
+	defer c.Stop()
+	for i := 0; i < 5; i++ {
+		c.Set(strconv.Itoa(i), i)
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	// all keys are dirty, cache is over capacity
+	if c.Len() != 5 {
+		t.Errorf("TestWriteBehindNotEvictDirty1 len %d <> 5", c.Len())
+	}
+	// a dirty key deleted from cache is read through the queue, not the stale store
+	store.Set("0", "stale")
+	c.(*localCache).delete("0")
+	if v, _ := c.Get("0"); v != 0 {
+		t.Errorf("TestWriteBehindNotEvictDirty2 get 0 = %v", v)
+	}
+}
+
+func TestWriteBehindFitAfterFlush(t *testing.T) {
+	for i, sharded := range []bool{false, true} {
+		store := &countStore{MapStore: NewMapStore()}
+		c := NewLocalCache(WithCapacity(2), WithShardCount(1), WithShardedPolicy(sharded),
+			WithBackingStore(store, WriteBehind), WithWriteBehind(WriteBehindConfig{BatchSize: 5, FlushInterval: time.Hour}))
+		// the fifth dirty key trigger a batch, keys are evicted after written
+		for j := 0; j < 5; j++ {
+			c.Set(strconv.Itoa(j), j)
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if store.batchCount() != 1 || c.Len() != 2 {
+			t.Errorf("TestWriteBehindFitAfterFlush%d batches %d len %d", i, store.batchCount(), c.Len())
+		}
+		c.Stop()
+	}
+}
+
+func TestWriteBehindStopBackoff(t *testing.T) {
+	store := &countStore{MapStore: NewMapStore(), failures: 100}
+	var deadOps []WriteOp
+	c := NewLocalCache(WithBackingStore(store, WriteBehind), WithWriteBehind(WriteBehindConfig{
+		FlushInterval: time.Millisecond,
+		RetryBackoff:  time.Hour,
+		DeadLetter:    func(ops []WriteOp, err error) { deadOps = append(deadOps, ops...) },
+	}))
+	c.Set("a", 1)
+	time.Sleep(10 * time.Millisecond)
+	// stop does not wait the backoff
+	start := time.Now()
+	c.Stop()
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("TestWriteBehindStopBackoff1 stop cost %v", cost)
+	}
+	if len(deadOps) != 1 || deadOps[0].Key != "a" {
+		t.Errorf("TestWriteBehindStopBackoff2 dead ops %v", deadOps)
+	}
+}